@@ -0,0 +1,104 @@
+package parsemail
+
+import (
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const reportTypeFeedbackReport = "feedback-report"
+
+// FeedbackReport with the fields of a RFC5965 abuse reporting format (ARF) report and the reported original
+// message, as sent by the feedback loops of mailbox providers
+type FeedbackReport struct {
+	FeedbackType          string
+	UserAgent             string
+	Version               string
+	SourceIP              string
+	OriginalMailFrom      string
+	OriginalRcptTo        []string
+	OriginalEnvelopeID    string
+	ArrivalDate           time.Time
+	ReportingMTA          string
+	ReportedDomain        []string
+	ReportedURI           []string
+	AuthenticationResults []string
+	Incidents             int
+
+	// OriginalMessage is nil when the reported message can't be parsed, it's still in OriginalMessageData
+	OriginalMessage     *Email
+	OriginalMessageData []byte
+}
+
+func (s *parseState) parseFeedbackReport(reports []reportPart) (fr *FeedbackReport, err error) {
+	for _, r := range reports {
+		switch r.contentType {
+		case "message/feedback-report":
+			groups := readFieldGroups(r.data)
+			if len(groups) == 0 || groups[0] == nil {
+				continue
+			}
+
+			g := groups[0]
+			hp := headerParser{}
+			fr = &FeedbackReport{
+				FeedbackType:          strings.ToLower(g.Get("Feedback-Type")),
+				UserAgent:             g.Get("User-Agent"),
+				Version:               g.Get("Version"),
+				SourceIP:              g.Get("Source-IP"),
+				OriginalMailFrom:      strings.Trim(g.Get("Original-Mail-From"), "<> "),
+				OriginalRcptTo:        trimFieldValues(g, "Original-Rcpt-To", "<> "),
+				OriginalEnvelopeID:    g.Get("Original-Envelope-Id"),
+				ArrivalDate:           hp.parseTime(g.Get("Arrival-Date")),
+				ReportingMTA:          stripFieldType(g.Get("Reporting-MTA")),
+				ReportedDomain:        trimFieldValues(g, "Reported-Domain", " "),
+				ReportedURI:           trimFieldValues(g, "Reported-URI", "<> "),
+				AuthenticationResults: trimFieldValues(g, "Authentication-Results", " "),
+			}
+
+			if incidents := g.Get("Incidents"); incidents != "" {
+				fr.Incidents, _ = strconv.Atoi(strings.TrimSpace(incidents))
+			}
+		}
+	}
+
+	if fr == nil {
+		return
+	}
+
+	for _, r := range reports {
+		switch r.contentType {
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			fr.OriginalMessageData = r.data
+
+			// the reported message is parsed within the limits of the report, as a part of it
+			if err := s.enterMultipart(); err != nil {
+				return nil, err
+			}
+
+			original, err := s.parseNested(append(r.data, '\n'))
+			s.leaveMultipart()
+
+			// the report is still useful when the reported message is malformed
+			if err == nil {
+				fr.OriginalMessage = &original
+			} else if s.isLimitError(err) {
+				return nil, err
+			}
+
+			return fr, nil
+		}
+	}
+
+	return
+}
+
+// trimFieldValues returns all the values of a possibly repeated report field trimmed of the cutset
+func trimFieldValues(h textproto.MIMEHeader, key, cutset string) (result []string) {
+	for _, v := range h[textproto.CanonicalMIMEHeaderKey(key)] {
+		result = append(result, strings.Trim(v, cutset))
+	}
+
+	return
+}
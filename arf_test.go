@@ -0,0 +1,148 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFeedbackReport(t *testing.T) {
+	e, err := Parse(strings.NewReader(arfExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := e.FeedbackReport
+	if fr == nil {
+		t.Fatal("Missing feedback report")
+	}
+
+	if fr.FeedbackType != "abuse" {
+		t.Errorf("Wrong feedback type. Got: %s", fr.FeedbackType)
+	}
+
+	if fr.UserAgent != "SomeGenerator/1.0" || fr.Version != "1" {
+		t.Errorf("Wrong user agent or version. Got: %s, %s", fr.UserAgent, fr.Version)
+	}
+
+	if fr.SourceIP != "192.0.2.2" {
+		t.Errorf("Wrong source IP. Got: %s", fr.SourceIP)
+	}
+
+	if fr.OriginalMailFrom != "somespammer@example.net" {
+		t.Errorf("Wrong original mail from. Got: %s", fr.OriginalMailFrom)
+	}
+
+	if !assertSliceEq(fr.OriginalRcptTo, []string{"user@example.com"}) {
+		t.Errorf("Wrong original rcpt to. Got: %s", fr.OriginalRcptTo)
+	}
+
+	if !fr.ArrivalDate.Equal(parseDate("Thu, 08 Mar 2005 14:00:00 -0500")) {
+		t.Errorf("Wrong arrival date. Got: %v", fr.ArrivalDate)
+	}
+
+	if !assertSliceEq(fr.ReportedDomain, []string{"example.net"}) {
+		t.Errorf("Wrong reported domain. Got: %s", fr.ReportedDomain)
+	}
+
+	if !assertSliceEq(fr.ReportedURI, []string{"http://example.net/earn_money.html", "mailto:user@example.com"}) {
+		t.Errorf("Wrong reported URI. Got: %s", fr.ReportedURI)
+	}
+
+	if fr.OriginalMessage == nil {
+		t.Fatal("Missing original message")
+	}
+
+	if fr.OriginalMessage.Subject != "Earn money" || fr.OriginalMessage.MessageID != "8787KJKJ3K4J3K4J3K4J3.mail@example.net" {
+		t.Errorf("Wrong original message. Got: %s, %s", fr.OriginalMessage.Subject, fr.OriginalMessage.MessageID)
+	}
+
+	if !strings.HasPrefix(fr.OriginalMessage.TextBody, "Spam Spam Spam\nSpam") {
+		t.Errorf("Wrong original message body. Got: '%s'", fr.OriginalMessage.TextBody)
+	}
+}
+
+func TestParseFeedbackReportUnparsedOriginal(t *testing.T) {
+	mailData := strings.Replace(arfExample, "Content-type: text/plain\n", "Content-type: multipart/mixed; boundary=inner\n", 1)
+	mailData = strings.Replace(mailData, "Spam Spam Spam\nSpam Spam Spam\nSpam Spam Spam\nSpam Spam Spam\n",
+		"--inner\nContent-Type: application/pdf\n\n%PDF-1.4\n--inner--\n", 1)
+
+	e, err := Parse(strings.NewReader(mailData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := e.FeedbackReport
+	if fr == nil {
+		t.Fatal("Missing feedback report")
+	}
+
+	if fr.FeedbackType != "abuse" {
+		t.Errorf("Wrong feedback type. Got: %s", fr.FeedbackType)
+	}
+
+	if fr.OriginalMessage != nil {
+		t.Errorf("Unexpected original message. Got: %+v", fr.OriginalMessage)
+	}
+
+	if !strings.Contains(string(fr.OriginalMessageData), "Subject: Earn money") {
+		t.Errorf("Wrong original message data. Got: '%s'", fr.OriginalMessageData)
+	}
+}
+
+// example from RFC5965 appendix B.2
+var arfExample = `From: <abusedesk@example.com>
+Date: Thu, 8 Mar 2005 17:40:36 EDT
+Subject: FW: Earn money
+To: <abuse@example.net>
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=feedback-report;
+     boundary="part1_13d.2e68ed54_boundary"
+
+--part1_13d.2e68ed54_boundary
+Content-Type: text/plain; charset="US-ASCII"
+Content-Transfer-Encoding: 7bit
+
+This is an email abuse report for an email message received from IP
+192.0.2.2 on Thu, 8 Mar 2005 14:00:00 EDT.
+For more information about this format please see
+http://www.mipassoc.org/arf/.
+
+--part1_13d.2e68ed54_boundary
+Content-Type: message/feedback-report
+
+Feedback-Type: abuse
+User-Agent: SomeGenerator/1.0
+Version: 1
+Original-Mail-From: <somespammer@example.net>
+Original-Rcpt-To: <user@example.com>
+Arrival-Date: Thu, 8 Mar 2005 14:00:00 -0500
+Reporting-MTA: dns; mail.example.com
+Source-IP: 192.0.2.2
+Authentication-Results: mail.example.com;
+               spf=fail smtp.mail=somespammer@example.com
+Reported-Domain: example.net
+Reported-Uri: http://example.net/earn_money.html
+Reported-Uri: mailto:user@example.com
+Removal-Recipient: user@example.com
+
+--part1_13d.2e68ed54_boundary
+Content-Type: message/rfc822
+Content-Disposition: inline
+
+From: <somespammer@example.net>
+Received: from mailserver.example.net (mailserver.example.net
+        [192.0.2.1]) by example.com with ESMTP id M63d4137594e46;
+        Thu, 08 Mar 2005 14:00:00 -0400
+To: <Undisclosed Recipients>
+Subject: Earn money
+MIME-Version: 1.0
+Content-type: text/plain
+Message-ID: 8787KJKJ3K4J3K4J3K4J3.mail@example.net
+Date: Thu, 02 Sep 2004 12:31:03 -0500
+
+Spam Spam Spam
+Spam Spam Spam
+Spam Spam Spam
+Spam Spam Spam
+--part1_13d.2e68ed54_boundary--
+`
@@ -0,0 +1,97 @@
+package parsemail
+
+import (
+	"encoding/base64"
+	"net/mail"
+	"strings"
+)
+
+// Autocrypt with the key and the encryption preference announced by the Autocrypt (or Autocrypt-Gossip) header,
+// see the Autocrypt Level 1 specification
+type Autocrypt struct {
+	Addr string
+	// PreferEncrypt is set for prefer-encrypt=mutual
+	PreferEncrypt bool
+	// KeyData is the OpenPGP public key (transferable public key, not armored)
+	KeyData []byte
+}
+
+// parseAutocrypt returns the key of the sender from the Autocrypt header, which is ignored unless there is exactly
+// one valid header matching the single From address
+func parseAutocrypt(header mail.Header, from []*mail.Address) *Autocrypt {
+	if len(from) != 1 {
+		return nil
+	}
+
+	var result *Autocrypt
+	for _, value := range header["Autocrypt"] {
+		ac, ok := parseAutocryptHeader(value)
+		if !ok || !strings.EqualFold(ac.Addr, from[0].Address) {
+			continue
+		}
+
+		if result != nil {
+			return nil
+		}
+
+		result = &ac
+	}
+
+	return result
+}
+
+// parseAutocryptGossip returns the keys of the Autocrypt-Gossip headers, which are only to be trusted in the header
+// of an encrypted entity
+func parseAutocryptGossip(header mail.Header) []Autocrypt {
+	var gossip []Autocrypt
+	for _, value := range header["Autocrypt-Gossip"] {
+		if ac, ok := parseAutocryptHeader(value); ok {
+			// the preference of the sender isn't gossiped
+			ac.PreferEncrypt = false
+			gossip = append(gossip, ac)
+		}
+	}
+
+	return gossip
+}
+
+// parseAutocryptHeader parses the attributes of an Autocrypt header. Unknown attributes make the header invalid,
+// unless they start with an underscore.
+func parseAutocryptHeader(value string) (ac Autocrypt, ok bool) {
+	var keyData string
+	for _, attribute := range strings.Split(value, ";") {
+		attribute = strings.TrimSpace(attribute)
+		if attribute == "" {
+			continue
+		}
+
+		i := strings.Index(attribute, "=")
+		if i < 0 {
+			return ac, false
+		}
+
+		name, v := strings.ToLower(strings.TrimSpace(attribute[:i])), strings.TrimSpace(attribute[i+1:])
+		switch {
+		case name == "addr":
+			ac.Addr = v
+		case name == "prefer-encrypt":
+			ac.PreferEncrypt = v == "mutual"
+		case name == "keydata":
+			keyData = strings.Join(strings.Fields(v), "")
+		case strings.HasPrefix(name, "_"):
+		default:
+			return ac, false
+		}
+	}
+
+	if ac.Addr == "" || keyData == "" {
+		return ac, false
+	}
+
+	var err error
+	if ac.KeyData, err = base64.StdEncoding.DecodeString(keyData); err != nil {
+		return ac, false
+	}
+
+	return ac, true
+}
@@ -0,0 +1,132 @@
+package parsemail
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestParseAutocrypt(t *testing.T) {
+	var testData = map[int]struct {
+		headers   string
+		autocrypt *Autocrypt
+	}{
+		1: {
+			headers: "From: Alice <alice@example.com>\nAutocrypt: addr=alice@example.com; keydata=\n a2V5\n ZGF0YQ==\n",
+			autocrypt: &Autocrypt{
+				Addr:    "alice@example.com",
+				KeyData: []byte("keydata"),
+			},
+		},
+		2: {
+			headers: "From: Alice <Alice@Example.com>\nAutocrypt: addr=alice@example.com; prefer-encrypt=mutual; _extra=1; keydata=a2V5ZGF0YQ==\n",
+			autocrypt: &Autocrypt{
+				Addr:          "alice@example.com",
+				PreferEncrypt: true,
+				KeyData:       []byte("keydata"),
+			},
+		},
+		3: {
+			// the address doesn't match the sender
+			headers: "From: Mallory <mallory@example.com>\nAutocrypt: addr=alice@example.com; keydata=a2V5ZGF0YQ==\n",
+		},
+		4: {
+			// more than one header for the sender
+			headers: "From: alice@example.com\nAutocrypt: addr=alice@example.com; keydata=a2V5ZGF0YQ==\nAutocrypt: addr=alice@example.com; keydata=b3RoZXI=\n",
+		},
+		5: {
+			// unknown critical attribute
+			headers: "From: alice@example.com\nAutocrypt: addr=alice@example.com; type=2; keydata=a2V5ZGF0YQ==\n",
+		},
+		6: {
+			headers: "From: alice@example.com\nAutocrypt: addr=alice@example.com; keydata=not base64!\n",
+		},
+		7: {
+			headers: "From: alice@example.com\nAutocrypt: addr=alice@example.com\n",
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.headers + "Subject: Test\n\nHello"))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if !assertAutocryptEq(td.autocrypt, e.Autocrypt) {
+			t.Errorf("[Test Case %v] Wrong Autocrypt. Expected: %+v, Got: %+v", index, td.autocrypt, e.Autocrypt)
+		}
+	}
+}
+
+func TestParseAutocryptGossip(t *testing.T) {
+	// gossip outside of an encrypted entity is ignored
+	e, err := Parse(strings.NewReader("From: alice@example.com\nAutocrypt-Gossip: addr=bob@example.com; keydata=Ym9i\n\nHello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.AutocryptGossip != nil {
+		t.Errorf("Unexpected gossip. Got: %+v", e.AutocryptGossip)
+	}
+
+	inner := "Content-Type: text/plain\r\nAutocrypt-Gossip: addr=bob@example.com; keydata=Ym9i\r\n" +
+		"Autocrypt-Gossip: addr=carol@example.com; prefer-encrypt=mutual; keydata=Y2Fyb2w=\r\n\r\nHello all\r\n"
+
+	message := `From: Alice <alice@example.com>
+To: bob@example.com, carol@example.com
+Subject: Encrypted
+Autocrypt: addr=alice@example.com; prefer-encrypt=mutual; keydata=YWxpY2U=
+Autocrypt-Gossip: addr=mallory@example.com; keydata=bWFsbG9yeQ==
+Content-Type: multipart/encrypted; protocol="application/pgp-encrypted"; boundary="enc"
+
+--enc
+Content-Type: application/pgp-encrypted
+
+Version: 1
+--enc
+Content-Type: application/octet-stream
+
+-----BEGIN PGP MESSAGE-----
+
+` + base64.StdEncoding.EncodeToString([]byte(inner)) + `
+-----END PGP MESSAGE-----
+--enc--
+`
+
+	e, err = ParsePGP(strings.NewReader(message), testPGPProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.TextBody != "Hello all" {
+		t.Errorf("Wrong text body. Expected: %s, Got: %s", "Hello all", e.TextBody)
+	}
+
+	if !assertAutocryptEq(&Autocrypt{Addr: "alice@example.com", PreferEncrypt: true, KeyData: []byte("alice")}, e.Autocrypt) {
+		t.Errorf("Wrong Autocrypt. Got: %+v", e.Autocrypt)
+	}
+
+	expected := []Autocrypt{
+		{Addr: "bob@example.com", KeyData: []byte("bob")},
+		{Addr: "carol@example.com", KeyData: []byte("carol")},
+	}
+
+	if len(e.AutocryptGossip) != len(expected) {
+		t.Fatalf("Wrong gossip. Expected: %+v, Got: %+v", expected, e.AutocryptGossip)
+	}
+
+	for i := range expected {
+		if !assertAutocryptEq(&expected[i], &e.AutocryptGossip[i]) {
+			t.Errorf("Wrong gossip. Expected: %+v, Got: %+v", expected[i], e.AutocryptGossip[i])
+		}
+	}
+}
+
+func assertAutocryptEq(a, b *Autocrypt) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Addr == b.Addr && a.PreferEncrypt == b.PreferEncrypt && string(a.KeyData) == string(b.KeyData)
+}
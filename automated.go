@@ -0,0 +1,115 @@
+package parsemail
+
+import (
+	"strings"
+)
+
+// Automation with the kinds of automated sending detected for an email and the signals they were detected by
+type Automation struct {
+	// AutoGenerated messages are sent by machines, e.g. notifications
+	AutoGenerated bool
+	// AutoReplied messages are automatic replies, e.g. vacation messages
+	AutoReplied bool
+	// Bulk messages are sent in bulk, e.g. newsletters
+	Bulk bool
+	// List messages are distributed by a mailing list
+	List bool
+	// Bounce messages report delivery failures
+	Bounce bool
+	// Reasons are the matched signals, e.g. "Auto-Submitted: auto-replied"
+	Reasons []string
+}
+
+// IsAutomated reports whether any kind of automation was detected. Automatic responders should not reply to such
+// messages (RFC3834).
+func (a Automation) IsAutomated() bool {
+	return a.AutoGenerated || a.AutoReplied || a.Bulk || a.List || a.Bounce
+}
+
+// Automation detects whether the email was sent automatically using the Auto-Submitted (RFC3834), Precedence,
+// X-Auto-Response-Suppress, X-Autoreply, List-* and Return-Path headers, the content type of reports and the senders
+// and subjects of bounces
+func (e Email) Automation() Automation {
+	var a Automation
+
+	reason := func(kind *bool, r string) {
+		*kind = true
+		a.Reasons = append(a.Reasons, r)
+	}
+
+	header := func(key string) string {
+		if e.Header == nil {
+			return ""
+		}
+
+		return strings.TrimSpace(e.Header.Get(key))
+	}
+
+	autoSubmitted := header("Auto-Submitted")
+	switch strings.ToLower(strings.TrimSpace(strings.SplitN(autoSubmitted, ";", 2)[0])) {
+	case "", "no":
+	case "auto-replied":
+		reason(&a.AutoReplied, "Auto-Submitted: "+autoSubmitted)
+	default:
+		// auto-generated, auto-notified and extensions
+		reason(&a.AutoGenerated, "Auto-Submitted: "+autoSubmitted)
+	}
+
+	for _, key := range []string{"Precedence", "X-Precedence"} {
+		precedence := header(key)
+		switch strings.ToLower(precedence) {
+		case "bulk", "junk":
+			reason(&a.Bulk, key+": "+precedence)
+		case "list":
+			reason(&a.List, key+": "+precedence)
+		case "auto_reply":
+			reason(&a.AutoReplied, key+": "+precedence)
+		}
+	}
+
+	if suppress := header("X-Auto-Response-Suppress"); suppress != "" {
+		suppressed := false
+		for _, v := range strings.Split(suppress, ",") {
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "all", "oof", "autoreply":
+				suppressed = true
+			}
+		}
+
+		if suppressed {
+			reason(&a.AutoGenerated, "X-Auto-Response-Suppress: "+suppress)
+		}
+	}
+
+	for _, key := range []string{"X-Autoreply", "X-Autorespond", "X-Autoresponder"} {
+		if v := header(key); v != "" && !strings.EqualFold(v, "no") {
+			reason(&a.AutoReplied, key+": "+v)
+		}
+	}
+
+	if e.List != nil && e.List.ID != "" {
+		reason(&a.List, "List-Id: "+e.List.ID)
+	} else if e.List != nil {
+		reason(&a.List, "List-* headers")
+	}
+
+	if returnPath := header("Return-Path"); returnPath == "<>" {
+		reason(&a.AutoGenerated, "Return-Path: <>")
+	}
+
+	contentType, params, err := parseContentType(e.ContentType)
+	if err == nil && contentType == contentTypeMultipartReport {
+		switch strings.ToLower(params["report-type"]) {
+		case reportTypeDeliveryStatus:
+			reason(&a.Bounce, "Content-Type: multipart/report; report-type="+params["report-type"])
+		default:
+			reason(&a.AutoGenerated, "Content-Type: multipart/report; report-type="+params["report-type"])
+		}
+	}
+
+	if !a.Bounce && isBounce(e) {
+		reason(&a.Bounce, "Bounce sender and subject")
+	}
+
+	return a
+}
@@ -0,0 +1,93 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAutomation(t *testing.T) {
+	var testData = map[int]struct {
+		mailData  string
+		automated bool
+		generated bool
+		replied   bool
+		bulk      bool
+		list      bool
+		bounce    bool
+		reasons   []string
+	}{
+		1: {
+			mailData: `From: Jane <jane@example.com>
+Subject: Out of office
+Auto-Submitted: auto-replied
+X-Autoreply: yes
+Content-Type: text/plain
+
+I am away.`,
+			automated: true,
+			replied:   true,
+			reasons:   []string{"Auto-Submitted: auto-replied", "X-Autoreply: yes"},
+		},
+		2: {
+			mailData: `From: CI <ci@example.com>
+Subject: Build failed
+Auto-Submitted: auto-generated
+X-Auto-Response-Suppress: DR, OOF, AutoReply
+Return-Path: <>
+Content-Type: text/plain
+
+Build #1 failed.`,
+			automated: true,
+			generated: true,
+			reasons:   []string{"Auto-Submitted: auto-generated", "X-Auto-Response-Suppress: DR, OOF, AutoReply", "Return-Path: <>"},
+		},
+		3: {
+			mailData: `From: News <news@example.com>
+Subject: Newsletter
+Precedence: bulk
+List-Id: News <news.example.com>
+List-Unsubscribe: <https://example.com/unsubscribe>
+Content-Type: text/plain
+
+News`,
+			automated: true,
+			bulk:      true,
+			list:      true,
+			reasons:   []string{"Precedence: bulk", "List-Id: news.example.com"},
+		},
+		4: {
+			mailData:  dsnExample,
+			automated: true,
+			bounce:    true,
+		},
+		5: {
+			mailData: `From: Jane <jane@example.com>
+Subject: Lunch?
+Auto-Submitted: no
+Content-Type: text/plain
+
+Lunch?`,
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		a := e.Automation()
+		if a.IsAutomated() != td.automated {
+			t.Errorf("[Test Case %v] Wrong automated. Expected: %v, Got: %v", index, td.automated, a.IsAutomated())
+		}
+
+		if a.AutoGenerated != td.generated || a.AutoReplied != td.replied || a.Bulk != td.bulk || a.List != td.list || a.Bounce != td.bounce {
+			t.Errorf("[Test Case %v] Wrong automation. Got: %+v", index, a)
+		}
+
+		if td.reasons != nil && !assertSliceEq(td.reasons, a.Reasons) {
+			t.Errorf("[Test Case %v] Wrong reasons. Expected: %v, Got: %v", index, td.reasons, a.Reasons)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package parsemail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/textproto"
+	"strings"
+	"unsafe"
+)
+
+// maxIndexDepth limits the nesting of the multipart bodies indexed in a message held in memory
+const maxIndexDepth = 64
+
+// ParseBytes parses an email message held in memory like Parse. Header values and the bodies of the message and of its
+// parts reference b rather than copying it, e.g. the Header, the text and html bodies, the Content and the data of
+// attachments, so b must not be modified while the email is in use. Values and bodies that are decoded, e.g. MIME
+// encoded words, folded header fields, transfer encoded or format=flowed bodies and text concatenated from several
+// parts, are copies.
+func ParseBytes(b []byte) (email Email, err error) {
+	return Parser{}.ParseBytes(b)
+}
+
+// ParseBytes parses an email message held in memory like the package ParseBytes, within the limits
+func (p Parser) ParseBytes(b []byte) (email Email, err error) {
+	return p.ParseBytesContext(context.Background(), b)
+}
+
+// ParseBytesContext parses an email message held in memory like ParseBytes, returning ctx.Err() once the context is
+// done
+func (p Parser) ParseBytesContext(ctx context.Context, b []byte) (email Email, err error) {
+	s := &parseState{ctx: ctx, limits: p.Limits, handlers: p.Handlers}
+
+	// messages over the size limit fail without being indexed
+	if p.Limits.MaxTotalBytes <= 0 || int64(len(b)) <= p.Limits.MaxTotalBytes {
+		s.entities = indexEntities(b, 0, nil)
+	}
+
+	email, err = s.parse(bytes.NewReader(b))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return Email{}, ctxErr
+	}
+
+	return
+}
+
+// parseNested parses a message held in memory which is nested in the message being parsed, e.g. the reported message
+// of a feedback report or the entity protected by security layers, sharing the state of the enclosing message. The
+// bytes of the nested message were already counted as read or decoded.
+func (s *parseState) parseNested(b []byte) (email Email, err error) {
+	entities, firstPart, base, bases := s.entities, s.firstPart, s.base, s.bases
+	defer func() {
+		s.entities, s.firstPart, s.base, s.bases = entities, firstPart, base, bases
+	}()
+
+	s.entities, s.firstPart, s.base, s.bases = nil, s.parts, "", nil
+	if s.limits.MaxTotalBytes <= 0 || int64(len(b)) <= s.limits.MaxTotalBytes {
+		s.entities = indexEntities(b, 0, nil)
+	}
+
+	s.read -= int64(len(b))
+
+	return s.parse(bytes.NewReader(b))
+}
+
+// indexedEntity is the header and the body of the message or of a body part held in memory
+type indexedEntity struct {
+	header []byte
+	body   []byte
+}
+
+// indexEntities appends the entity and its nested body parts, in the order the parts are parsed
+func indexEntities(entity []byte, depth int, entities []indexedEntity) []indexedEntity {
+	header, body := splitEntity(entity)
+	entities = append(entities, indexedEntity{header: header, body: body})
+
+	mediaType, params, err := mime.ParseMediaType(headerValue(header, "Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || depth >= maxIndexDepth {
+		return entities
+	}
+
+	parts, err := splitMultipart(body, params["boundary"])
+	if err != nil {
+		return entities
+	}
+
+	for _, part := range parts {
+		entities = indexEntities(part, depth+1, entities)
+	}
+
+	return entities
+}
+
+// indexedEntity returns the indexed entity of the current part, or of the message before the first part
+func (s *parseState) indexedEntity() (indexedEntity, bool) {
+	i := s.parts - s.firstPart
+	if i < 0 || i >= len(s.entities) {
+		return indexedEntity{}, false
+	}
+
+	return s.entities[i], true
+}
+
+// referenceHeader replaces the values of the header parsed from raw by strings referencing raw. Folded fields, whose
+// values are unfolded, and values that differ from raw keep their copies.
+func referenceHeader(header map[string][]string, raw []byte) {
+	seen := map[string]int{}
+	for len(raw) > 0 {
+		line := raw
+		raw = nil
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, raw = line[:i], line[i+1:]
+		}
+
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+
+		key := textproto.CanonicalMIMEHeaderKey(string(line[:colon]))
+		n := seen[key]
+		seen[key]++
+
+		folded := len(raw) > 0 && (raw[0] == ' ' || raw[0] == '\t')
+		if folded || n >= len(header[key]) {
+			continue
+		}
+
+		value := bytes.TrimRight(bytes.TrimLeft(line[colon+1:], " \t"), " \t\r")
+		if string(value) == header[key][n] {
+			header[key][n] = bytesString(value)
+		}
+	}
+}
+
+// bytesString returns a string referencing b, which must not be modified while the string is in use
+func bytesString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// splitEntity splits a MIME entity at the empty line ending its header
+func splitEntity(entity []byte) (header []byte, body []byte) {
+	for off := 0; off < len(entity); {
+		end := len(entity)
+		if i := bytes.IndexByte(entity[off:], '\n'); i >= 0 {
+			end = off + i + 1
+		}
+
+		if len(bytes.TrimRight(entity[off:end], "\r\n")) == 0 {
+			return entity[:off], entity[end:]
+		}
+
+		off = end
+	}
+
+	return entity, nil
+}
+
+// headerValue returns the unfolded value of the first header field with the name
+func headerValue(header []byte, name string) string {
+	var value []string
+	found := false
+	for _, line := range strings.Split(string(header), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case found && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			value = append(value, strings.TrimSpace(line))
+		case found:
+			return strings.Join(value, " ")
+		case len(line) > len(name) && line[len(name)] == ':' && strings.EqualFold(line[:len(name)], name):
+			found = true
+			value = append(value, strings.TrimSpace(line[len(name)+1:]))
+		}
+	}
+
+	return strings.Join(value, " ")
+}
+
+// readPart reads the body of the current part, or of the message before the first part. When the message is held in
+// memory, the body is referenced rather than copied, as long as it's the same as the body indexed for the part.
+func (s *parseState) readPart(r io.Reader) ([]byte, error) {
+	b, _, err := s.readBody(r)
+
+	return b, err
+}
+
+// readText reads the body of the current part like readPart, as a string referencing the message held in memory
+func (s *parseState) readText(r io.Reader) (string, error) {
+	b, referenced, err := s.readBody(r)
+	if err != nil {
+		return "", err
+	}
+
+	if referenced {
+		return bytesString(b), nil
+	}
+
+	return string(b), nil
+}
+
+// readBody reads the body of the current part, reporting whether it references the message held in memory
+func (s *parseState) readBody(r io.Reader) (b []byte, referenced bool, err error) {
+	e, ok := s.indexedEntity()
+	if !ok {
+		b, err = ioutil.ReadAll(r)
+		return b, false, err
+	}
+
+	body := e.body
+	if s.buf == nil {
+		s.buf = make([]byte, 4096)
+	}
+
+	n := 0
+	for {
+		m, err := r.Read(s.buf)
+		if m > 0 && !bytes.HasPrefix(body[n:], s.buf[:m]) {
+			// e.g. quoted-printable bodies decoded by the multipart reader
+			var b bytes.Buffer
+			b.Write(body[:n])
+			b.Write(s.buf[:m])
+			if err == nil {
+				_, err = b.ReadFrom(r)
+			} else if err == io.EOF {
+				err = nil
+			}
+
+			return b.Bytes(), false, err
+		}
+
+		n += m
+
+		if err == io.EOF {
+			// appending to the body mustn't overwrite the message
+			return body[:n:n], true, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// decodeContent decodes the body of the current part like decodeContent, referencing bodies which aren't transfer
+// encoded when the message is held in memory
+func (s *parseState) decodeContent(content io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "", "7bit", "8bit", "binary":
+		b, err := s.readPart(content)
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(b), nil
+	case "x-uuencode", "x-uue", "uuencode":
+		b, err := s.readPart(content)
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeUUEncodedData(b)
+	default:
+		return decodeContent(content, encoding)
+	}
+}
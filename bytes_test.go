@@ -0,0 +1,179 @@
+package parsemail
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+	}{
+		1:  {mailData: data1},
+		2:  {mailData: data2},
+		3:  {mailData: textPlainInMultipart},
+		4:  {mailData: textHTMLInMultipart},
+		5:  {mailData: rfc5322exampleA11},
+		6:  {mailData: imageContentExample},
+		7:  {mailData: multipartRelatedExample},
+		8:  {mailData: attachment7bit},
+		9:  {mailData: calendarTopLevelExample},
+		10: {mailData: dsnExample},
+		11: {mailData: tnefExample},
+		12: {mailData: uuencodeAttachmentExample},
+		13: {mailData: quotedPrintablePartsExample},
+		14: {mailData: strings.Replace(attachment7bit, "\n", "\r\n", -1)},
+	}
+
+	for index, td := range testData {
+		expected, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] Parse failed: %v", index, err)
+			continue
+		}
+
+		e, err := ParseBytes([]byte(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] ParseBytes failed: %v", index, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(e, expected) {
+			t.Errorf("[Test Case %v] Wrong email. Expected: %+v, Got: %+v", index, expected, e)
+		}
+	}
+}
+
+func TestParseBytesReferencesInput(t *testing.T) {
+	b := []byte(attachment7bit)
+
+	e, err := ParseBytes(b)
+	if err != nil {
+		t.Fatalf("ParseBytes failed: %v", err)
+	}
+
+	if len(e.Attachments) != 1 {
+		t.Fatalf("Wrong attachments. Expected: 1, Got: %v", len(e.Attachments))
+	}
+
+	// the attachment isn't transfer encoded, so its data is the input
+	copy(b[bytes.Index(b, []byte(`"Foo"`)):], `"Qux"`)
+
+	data, err := ioutil.ReadAll(e.Attachments[0].Data)
+	if err != nil {
+		t.Fatalf("Reading the attachment failed: %v", err)
+	}
+
+	expected := "\n\"Some\", \"Data\", \"In\", \"Csv\", \"Format\"\n\"Qux\", \"Bar\", \"Baz\", \"Bum\", \"Poo\"\n"
+	if string(data) != expected {
+		t.Errorf("Wrong attachment data. Expected: %q, Got: %q", expected, data)
+	}
+}
+
+func TestParseBytesReferencesHeaderAndText(t *testing.T) {
+	b := []byte(textPlainInMultipart)
+
+	e, err := ParseBytes(b)
+	if err != nil {
+		t.Fatalf("ParseBytes failed: %v", err)
+	}
+
+	subject, textBody := e.Subject, e.TextBody
+
+	// the header values and the text body aren't decoded, so they are the input
+	for _, s := range []string{subject, textBody} {
+		i := bytes.Index(b, []byte(s))
+		copy(b[i:], bytes.ToUpper(b[i:i+len(s)]))
+	}
+
+	if e.Subject != strings.ToUpper(subject) || e.Header.Get("Subject") != strings.ToUpper(subject) {
+		t.Errorf("Wrong subject. Expected: %s, Got: %s", strings.ToUpper(subject), e.Subject)
+	}
+
+	if e.TextBody != strings.ToUpper(textBody) {
+		t.Errorf("Wrong text body. Expected: %s, Got: %s", strings.ToUpper(textBody), e.TextBody)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	message := benchmarkMessage()
+
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(bytes.NewReader(message)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseBytes(b *testing.B) {
+	message := benchmarkMessage()
+
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseBytes(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkMessage returns a message with text and html bodies and a 1 MiB attachment
+func benchmarkMessage() []byte {
+	var b bytes.Buffer
+	b.WriteString("From: John Doe <jdoe@machine.example>\n" +
+		"To: Mary Smith <mary@example.net>\n" +
+		"Subject: Report\n" +
+		"Date: Fri, 21 Nov 1997 09:55:06 -0600\n" +
+		"Message-ID: <1234@local.machine.example>\n" +
+		"Content-Type: multipart/mixed; boundary=outer\n" +
+		"\n" +
+		"--outer\n" +
+		"Content-Type: multipart/alternative; boundary=inner\n" +
+		"\n" +
+		"--inner\n" +
+		"Content-Type: text/plain; charset=UTF-8\n" +
+		"\n" +
+		strings.Repeat("The report is attached.\n", 200) +
+		"--inner\n" +
+		"Content-Type: text/html; charset=UTF-8\n" +
+		"\n" +
+		strings.Repeat("<p>The report is attached.</p>\n", 200) +
+		"--inner--\n" +
+		"--outer\n" +
+		"Content-Type: text/csv; name=\"report.csv\"\n" +
+		"Content-Transfer-Encoding: 8bit\n" +
+		"Content-Disposition: attachment; filename=\"report.csv\"\n" +
+		"\n")
+
+	for b.Len() < 1<<20 {
+		b.WriteString("\"Some\", \"Data\", \"In\", \"Csv\", \"Format\"\n")
+	}
+
+	b.WriteString("--outer--\n")
+
+	return b.Bytes()
+}
+
+var quotedPrintablePartsExample = `From: John Doe <jdoe@machine.example>
+Subject: Quoted-printable
+Content-Type: multipart/mixed; boundary=outer
+
+--outer
+Content-Type: text/plain; charset=UTF-8
+Content-Transfer-Encoding: quoted-printable
+
+Caf=C3=A9 au lait, a long line that is soft =
+broken.
+--outer
+Content-Type: text/plain; name="notes.txt"
+Content-Transfer-Encoding: quoted-printable
+Content-Disposition: attachment; filename="notes.txt"
+
+Caf=C3=A9
+--outer--
+`
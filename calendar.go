@@ -0,0 +1,329 @@
+package parsemail
+
+import (
+	"io"
+	"mime/multipart"
+	"net/mail"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar with the method and events of a RFC5545 iCalendar object, as sent in meeting invitations
+type Calendar struct {
+	Method string
+	ProdID string
+	Events []Event
+}
+
+// Event with the scheduling fields of a VEVENT component. Start and End are in the location of their TZID if it is
+// known to the time package, otherwise in UTC; the TZID itself is kept in Timezone.
+type Event struct {
+	UID         string
+	Sequence    int
+	Status      string
+	Summary     string
+	Description string
+	Location    string
+
+	Organizer *mail.Address
+	Attendees []Attendee
+
+	Start    time.Time
+	End      time.Time
+	AllDay   bool
+	Timezone string
+	RRule    string
+}
+
+// Attendee of an event with its role, participation status and whether a reply is expected
+type Attendee struct {
+	Name     string
+	Address  string
+	Role     string
+	PartStat string
+	RSVP     bool
+}
+
+// contentLine is a single unfolded "NAME;PARAM=VALUE:value" line as used by iCalendar and vCard
+type contentLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func (s *parseState) parseCalendarPart(part *multipart.Part, email *Email) error {
+	decoded, err := s.decodeContent(part, part.Header.Get("Content-Transfer-Encoding"))
+	if err != nil {
+		return err
+	}
+
+	cals, err := parseCalendarData(decoded)
+	if err != nil {
+		return err
+	}
+
+	email.Calendars = append(email.Calendars, cals...)
+
+	return nil
+}
+
+func isCalendarAttachment(at Attachment) bool {
+	contentType := strings.ToLower(at.ContentType)
+
+	return contentType == contentTypeTextCalendar || contentType == "application/ics" ||
+		strings.ToLower(path.Ext(at.Filename)) == ".ics"
+}
+
+func decodeCalendarAttachments(email *Email) error {
+	for _, at := range email.Attachments {
+		if isCalendarAttachment(at) {
+			data, err := readData(at.Data)
+			if err != nil {
+				return err
+			}
+
+			email.Calendars = append(email.Calendars, parseCalendar(string(data))...)
+		}
+	}
+
+	return nil
+}
+
+func parseCalendarData(r io.Reader) ([]Calendar, error) {
+	data, err := readData(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCalendar(string(data)), nil
+}
+
+func parseCalendar(data string) (calendars []Calendar) {
+	var cal *Calendar
+	var event *Event
+	var components []string
+
+	for _, line := range unfoldContentLines(data) {
+		cl, ok := parseContentLine(line)
+		if !ok {
+			continue
+		}
+
+		switch cl.name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(cl.value))
+			switch strings.ToUpper(cl.value) {
+			case "VCALENDAR":
+				calendars = append(calendars, Calendar{})
+				cal = &calendars[len(calendars)-1]
+			case "VEVENT":
+				if cal != nil && len(components) == 2 {
+					cal.Events = append(cal.Events, Event{})
+					event = &cal.Events[len(cal.Events)-1]
+				}
+			}
+
+			continue
+		case "END":
+			if len(components) > 0 {
+				components = components[:len(components)-1]
+			}
+
+			switch strings.ToUpper(cl.value) {
+			case "VCALENDAR":
+				cal = nil
+			case "VEVENT":
+				event = nil
+			}
+
+			continue
+		}
+
+		if cal == nil {
+			continue
+		}
+
+		if len(components) == 1 {
+			switch cl.name {
+			case "METHOD":
+				cal.Method = strings.ToUpper(cl.value)
+			case "PRODID":
+				cal.ProdID = cl.value
+			}
+
+			continue
+		}
+
+		if event == nil || len(components) != 2 {
+			continue
+		}
+
+		switch cl.name {
+		case "UID":
+			event.UID = cl.value
+		case "SEQUENCE":
+			event.Sequence, _ = strconv.Atoi(cl.value)
+		case "STATUS":
+			event.Status = strings.ToUpper(cl.value)
+		case "SUMMARY":
+			event.Summary = unescapeText(cl.value)
+		case "DESCRIPTION":
+			event.Description = unescapeText(cl.value)
+		case "LOCATION":
+			event.Location = unescapeText(cl.value)
+		case "ORGANIZER":
+			event.Organizer = &mail.Address{Name: cl.params["CN"], Address: calendarAddress(cl.value)}
+		case "ATTENDEE":
+			event.Attendees = append(event.Attendees, Attendee{
+				Name:     cl.params["CN"],
+				Address:  calendarAddress(cl.value),
+				Role:     strings.ToUpper(cl.params["ROLE"]),
+				PartStat: strings.ToUpper(cl.params["PARTSTAT"]),
+				RSVP:     strings.EqualFold(cl.params["RSVP"], "TRUE"),
+			})
+		case "DTSTART":
+			event.Start, event.AllDay = parseCalendarTime(cl)
+			event.Timezone = cl.params["TZID"]
+		case "DTEND":
+			event.End, _ = parseCalendarTime(cl)
+		case "RRULE":
+			event.RRule = cl.value
+		}
+	}
+
+	return
+}
+
+// parseCalendarTime parses a DATE or DATE-TIME value in the location given by its TZID parameter
+func parseCalendarTime(cl contentLine) (t time.Time, allDay bool) {
+	loc := time.UTC
+	if tzid := cl.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.Trim(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+
+	value := strings.TrimSpace(cl.value)
+	if strings.HasSuffix(value, "Z") {
+		t, _ = time.Parse("20060102T150405Z", value)
+		return t, false
+	}
+
+	if len(value) == len("20060102") {
+		t, _ = time.ParseInLocation("20060102", value, loc)
+		return t, true
+	}
+
+	t, _ = time.ParseInLocation("20060102T150405", value, loc)
+
+	return t, false
+}
+
+func calendarAddress(value string) string {
+	if strings.HasPrefix(strings.ToLower(value), "mailto:") {
+		return value[len("mailto:"):]
+	}
+
+	return value
+}
+
+// unfoldContentLines splits the data into lines, joining lines that are continued by a leading space or tab
+func unfoldContentLines(data string) (lines []string) {
+	data = strings.Replace(data, "\r\n", "\n", -1)
+
+	for _, line := range strings.Split(data, "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return
+}
+
+// parseContentLine splits a content line into its upper cased name, its parameters and its value. Repeated
+// parameters are joined with a comma and group prefixes (e.g. "item1.EMAIL") are dropped.
+func parseContentLine(line string) (cl contentLine, ok bool) {
+	inQuotes := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+
+	if colon == -1 {
+		return cl, false
+	}
+
+	cl.value = line[colon+1:]
+	cl.params = map[string]string{}
+
+	fields := splitUnquoted(line[:colon], ';')
+	cl.name = strings.ToUpper(strings.TrimSpace(fields[0]))
+	if i := strings.LastIndex(cl.name, "."); i != -1 {
+		cl.name = cl.name[i+1:]
+	}
+
+	for _, p := range fields[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		key := strings.ToUpper(strings.TrimSpace(kv[0]))
+		if len(kv) == 1 {
+			// vCard 2.1 allows bare parameter values, e.g. "TEL;WORK;VOICE:" or "NOTE;QUOTED-PRINTABLE:"
+			key = bareParameterName(kv[0])
+			kv = []string{key, kv[0]}
+		}
+
+		value := strings.Trim(kv[1], `"`)
+		if cl.params[key] != "" {
+			value = cl.params[key] + "," + value
+		}
+
+		cl.params[key] = value
+	}
+
+	return cl, true
+}
+
+// bareParameterName returns the name of a vCard 2.1 parameter given by its value only
+func bareParameterName(value string) string {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "QUOTED-PRINTABLE", "BASE64", "8BIT", "7BIT":
+		return "ENCODING"
+	case "UTF-8", "US-ASCII", "ISO-8859-1", "LATIN1", "WINDOWS-1252":
+		return "CHARSET"
+	default:
+		return "TYPE"
+	}
+}
+
+func splitUnquoted(s string, sep rune) (result []string) {
+	inQuotes := false
+	start := 0
+	for i, c := range s {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == sep && !inQuotes {
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(result, s[start:])
+}
+
+// unescapeText resolves the backslash escapes of TEXT values
+func unescapeText(s string) string {
+	r := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+	return r.Replace(s)
+}
@@ -0,0 +1,164 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCalendar(t *testing.T) {
+	var testData = map[int]struct {
+		mailData    string
+		textBody    string
+		attachments int
+	}{
+		1: {mailData: calendarInAlternativeExample, textBody: "You have been invited to Project sync"},
+		2: {mailData: calendarAttachmentExample, textBody: "Invitation attached", attachments: 1},
+		3: {mailData: calendarTopLevelExample},
+		4: {
+			mailData: strings.NewReplacer("application/ics", "Text/Calendar", "invite.ics", "invite.dat").
+				Replace(calendarAttachmentExample),
+			textBody:    "Invitation attached",
+			attachments: 1,
+		},
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if td.textBody != e.TextBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: '%s', Got: '%s'", index, td.textBody, e.TextBody)
+		}
+
+		if td.attachments != len(e.Attachments) {
+			t.Errorf("[Test Case %v] Incorrect number of attachments! Expected: %v, Got: %v.", index, td.attachments, len(e.Attachments))
+		}
+
+		if len(e.Calendars) != 1 || len(e.Calendars[0].Events) != 1 {
+			t.Errorf("[Test Case %v] Expected a single calendar with a single event, Got: %+v", index, e.Calendars)
+			continue
+		}
+
+		if e.Calendars[0].Method != "REQUEST" {
+			t.Errorf("[Test Case %v] Wrong method. Got: %s", index, e.Calendars[0].Method)
+		}
+
+		ev := e.Calendars[0].Events[0]
+		if ev.UID != "040000008200E00074C5B7101A82E008" || ev.Sequence != 2 || ev.Summary != "Project sync, weekly" {
+			t.Errorf("[Test Case %v] Wrong event. Got: %+v", index, ev)
+		}
+
+		if ev.Description != "Agenda:\nstatus; blockers" {
+			t.Errorf("[Test Case %v] Wrong description. Got: '%s'", index, ev.Description)
+		}
+
+		if ev.Organizer == nil || ev.Organizer.Name != "John Doe" || ev.Organizer.Address != "jdoe@machine.example" {
+			t.Errorf("[Test Case %v] Wrong organizer. Got: %v", index, ev.Organizer)
+		}
+
+		if len(ev.Attendees) != 2 {
+			t.Errorf("[Test Case %v] Incorrect number of attendees! Expected: 2, Got: %v.", index, len(ev.Attendees))
+		} else if a := ev.Attendees[0]; a.Name != "Mary Smith" || a.Address != "mary@example.net" || a.Role != "REQ-PARTICIPANT" || a.PartStat != "NEEDS-ACTION" || !a.RSVP {
+			t.Errorf("[Test Case %v] Wrong attendee. Got: %+v", index, a)
+		}
+
+		if !ev.Start.Equal(time.Date(2020, 5, 4, 10, 0, 0, 0, ny)) || ev.Timezone != "America/New_York" || ev.AllDay {
+			t.Errorf("[Test Case %v] Wrong start. Got: %v %s", index, ev.Start, ev.Timezone)
+		}
+
+		if !ev.End.Equal(time.Date(2020, 5, 4, 15, 30, 0, 0, time.UTC)) {
+			t.Errorf("[Test Case %v] Wrong end. Got: %v", index, ev.End)
+		}
+
+		if ev.RRule != "FREQ=WEEKLY;BYDAY=MO;COUNT=10" {
+			t.Errorf("[Test Case %v] Wrong rrule. Got: %s", index, ev.RRule)
+		}
+	}
+}
+
+var calendarExample = "BEGIN:VCALENDAR\r\n" +
+	"PRODID:-//Example//Calendar 1.0//EN\r\n" +
+	"VERSION:2.0\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:040000008200E00074C5B7101A82E008\r\n" +
+	"SEQUENCE:2\r\n" +
+	"SUMMARY:Project sync\\, weekly\r\n" +
+	"DESCRIPTION:Agenda:\\nstatus\\; bloc\r\n" +
+	" kers\r\n" +
+	"ORGANIZER;CN=\"John Doe\":mailto:jdoe@machine.example\r\n" +
+	"ATTENDEE;CN=Mary Smith;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:\r\n" +
+	" mailto:mary@example.net\r\n" +
+	"ATTENDEE;CN=Jane Brown;ROLE=OPT-PARTICIPANT:mailto:j-brown@other.example\r\n" +
+	"DTSTART;TZID=America/New_York:20200504T100000\r\n" +
+	"DTEND:20200504T153000Z\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=10\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"DESCRIPTION:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+var calendarInAlternativeExample = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: Invitation: Project sync
+Date: Fri, 01 May 2020 09:55:06 -0600
+Content-Type: multipart/alternative; boundary="000000000000ab2e1f05a26de586"
+
+--000000000000ab2e1f05a26de586
+Content-Type: text/plain; charset="UTF-8"
+
+You have been invited to Project sync
+--000000000000ab2e1f05a26de586
+Content-Type: text/calendar; charset="UTF-8"; method=REQUEST
+
+` + calendarExample + `
+--000000000000ab2e1f05a26de586--
+`
+
+var calendarAttachmentExample = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: Invitation: Project sync
+Date: Fri, 01 May 2020 09:55:06 -0600
+Content-Type: multipart/mixed; boundary="000000000000ab2e2205a26de587"
+
+--000000000000ab2e2205a26de587
+Content-Type: text/plain; charset="UTF-8"
+
+Invitation attached
+--000000000000ab2e2205a26de587
+Content-Type: application/ics; name="invite.ics"
+Content-Disposition: attachment; filename="invite.ics"
+Content-Transfer-Encoding: base64
+
+QkVHSU46VkNBTEVOREFSDQpQUk9ESUQ6LS8vRXhhbXBsZS8vQ2FsZW5kYXIgMS4wLy9FTg0KVkVS
+U0lPTjoyLjANCk1FVEhPRDpSRVFVRVNUDQpCRUdJTjpWRVZFTlQNClVJRDowNDAwMDAwMDgyMDBF
+MDAwNzRDNUI3MTAxQTgyRTAwOA0KU0VRVUVOQ0U6Mg0KU1VNTUFSWTpQcm9qZWN0IHN5bmNcLCB3
+ZWVrbHkNCkRFU0NSSVBUSU9OOkFnZW5kYTpcbnN0YXR1c1w7IGJsb2MNCiBrZXJzDQpPUkdBTkla
+RVI7Q049IkpvaG4gRG9lIjptYWlsdG86amRvZUBtYWNoaW5lLmV4YW1wbGUNCkFUVEVOREVFO0NO
+PU1hcnkgU21pdGg7Uk9MRT1SRVEtUEFSVElDSVBBTlQ7UEFSVFNUQVQ9TkVFRFMtQUNUSU9OO1JT
+VlA9VFJVRToNCiBtYWlsdG86bWFyeUBleGFtcGxlLm5ldA0KQVRURU5ERUU7Q049SmFuZSBCcm93
+bjtST0xFPU9QVC1QQVJUSUNJUEFOVDptYWlsdG86ai1icm93bkBvdGhlci5leGFtcGxlDQpEVFNU
+QVJUO1RaSUQ9QW1lcmljYS9OZXdfWW9yazoyMDIwMDUwNFQxMDAwMDANCkRURU5EOjIwMjAwNTA0
+VDE1MzAwMFoNClJSVUxFOkZSRVE9V0VFS0xZO0JZREFZPU1PO0NPVU5UPTEwDQpCRUdJTjpWQUxB
+Uk0NCkRFU0NSSVBUSU9OOlJlbWluZGVyDQpFTkQ6VkFMQVJNDQpFTkQ6VkVWRU5UDQpFTkQ6VkNB
+TEVOREFSDQo=
+--000000000000ab2e2205a26de587--
+`
+
+var calendarTopLevelExample = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: Invitation: Project sync
+Date: Fri, 01 May 2020 09:55:06 -0600
+Content-Type: text/calendar; charset="UTF-8"; method=REQUEST
+
+` + calendarExample
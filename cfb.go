@@ -0,0 +1,281 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Compound File Binary (OLE) container as used by Outlook .msg files, see MS-CFB
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbNoStream   = 0xFFFFFFFF
+
+	cfbTypeStorage = 1
+	cfbTypeStream  = 2
+	cfbTypeRoot    = 5
+)
+
+var errInvalidCFB = errors.New("invalid compound file")
+
+type cfbFile struct {
+	r          io.ReaderAt
+	sectorSize int
+	cutoff     uint64
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	entries    []cfbEntry
+	// parsed are the storages already parsed as messages
+	parsed map[int]bool
+}
+
+type cfbEntry struct {
+	name  string
+	typ   byte
+	left  uint32
+	right uint32
+	child uint32
+	start uint32
+	size  uint64
+}
+
+func openCFB(r io.ReaderAt) (*cfbFile, error) {
+	header := make([]byte, 512)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:8], cfbSignature) {
+		return nil, errInvalidCFB
+	}
+
+	shift := binary.LittleEndian.Uint16(header[0x1E:])
+	if shift != 9 && shift != 12 {
+		return nil, errInvalidCFB
+	}
+
+	f := &cfbFile{
+		r:          r,
+		sectorSize: 1 << shift,
+		cutoff:     uint64(binary.LittleEndian.Uint32(header[0x38:])),
+		parsed:     map[int]bool{},
+	}
+
+	// the sector ids of the FAT are listed in the header and in the chain of DIFAT sectors
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		fatSectors = append(fatSectors, binary.LittleEndian.Uint32(header[0x4C+i*4:]))
+	}
+
+	// the chain can't have more sectors than the file after the header, nor revisit a sector
+	maxSectors := uint32(cfbEndOfChain)
+	if size, ok := readerSize(r); ok {
+		maxSectors = uint32((size - 1) / int64(f.sectorSize))
+	}
+
+	visited := map[uint32]bool{}
+	difat := binary.LittleEndian.Uint32(header[0x44:])
+	for n := binary.LittleEndian.Uint32(header[0x48:]); n > 0 && difat < cfbEndOfChain; n-- {
+		if visited[difat] || uint32(len(visited)) >= maxSectors {
+			return nil, errInvalidCFB
+		}
+
+		visited[difat] = true
+
+		sector, err := f.sector(difat)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := f.sectorSize/4 - 1
+		for i := 0; i < entries; i++ {
+			fatSectors = append(fatSectors, binary.LittleEndian.Uint32(sector[i*4:]))
+		}
+
+		difat = binary.LittleEndian.Uint32(sector[entries*4:])
+	}
+
+	fatCount := int(binary.LittleEndian.Uint32(header[0x2C:]))
+	if fatCount > len(fatSectors) {
+		return nil, errInvalidCFB
+	}
+
+	for _, id := range fatSectors[:fatCount] {
+		sector, err := f.sector(id)
+		if err != nil {
+			return nil, err
+		}
+
+		f.fat = append(f.fat, uint32Slice(sector)...)
+	}
+
+	miniFAT, err := f.chain(binary.LittleEndian.Uint32(header[0x3C:]), f.fat, f.sectorSize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	f.miniFAT = uint32Slice(miniFAT)
+
+	directory, err := f.chain(binary.LittleEndian.Uint32(header[0x30:]), f.fat, f.sectorSize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i+128 <= len(directory); i += 128 {
+		f.entries = append(f.entries, parseCFBEntry(directory[i:i+128]))
+	}
+
+	if len(f.entries) == 0 || f.entries[0].typ != cfbTypeRoot {
+		return nil, errInvalidCFB
+	}
+
+	f.miniStream, err = f.chain(f.entries[0].start, f.fat, f.sectorSize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func parseCFBEntry(b []byte) cfbEntry {
+	nameLength := int(binary.LittleEndian.Uint16(b[0x40:]))
+	if nameLength > 64 {
+		nameLength = 64
+	}
+
+	e := cfbEntry{
+		name:  strings.TrimRight(decodeUTF16(b[:nameLength]), "\x00"),
+		typ:   b[0x42],
+		left:  binary.LittleEndian.Uint32(b[0x44:]),
+		right: binary.LittleEndian.Uint32(b[0x48:]),
+		child: binary.LittleEndian.Uint32(b[0x4C:]),
+		start: binary.LittleEndian.Uint32(b[0x74:]),
+		size:  binary.LittleEndian.Uint64(b[0x78:]),
+	}
+
+	// version 3 files may have garbage in the high bits
+	e.size &= 0xFFFFFFFF
+
+	return e
+}
+
+func (f *cfbFile) sector(id uint32) ([]byte, error) {
+	b := make([]byte, f.sectorSize)
+	n, err := f.r.ReadAt(b, (int64(id)+1)*int64(f.sectorSize))
+	if n == 0 && err == io.EOF {
+		return nil, errInvalidCFB
+	}
+
+	// the last sector may be truncated
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// chain reads the sectors of a chain of the FAT or the mini FAT (with the mini stream as source)
+func (f *cfbFile) chain(start uint32, fat []uint32, size int, source []byte) ([]byte, error) {
+	var b []byte
+	visited := map[uint32]bool{}
+	for id := start; id != cfbEndOfChain && id != cfbNoStream; {
+		if int(id) >= len(fat) || visited[id] {
+			return nil, errInvalidCFB
+		}
+
+		visited[id] = true
+
+		if source == nil {
+			sector, err := f.sector(id)
+			if err != nil {
+				return nil, err
+			}
+
+			b = append(b, sector...)
+		} else {
+			if (int(id)+1)*size > len(source) {
+				return nil, errInvalidCFB
+			}
+
+			b = append(b, source[int(id)*size:(int(id)+1)*size]...)
+		}
+
+		id = fat[id]
+	}
+
+	return b, nil
+}
+
+// stream returns the data of the stream entry
+func (f *cfbFile) stream(e cfbEntry) ([]byte, error) {
+	var b []byte
+	var err error
+	if e.size < f.cutoff {
+		b, err = f.chain(e.start, f.miniFAT, 64, f.miniStream)
+	} else {
+		b, err = f.chain(e.start, f.fat, f.sectorSize, nil)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(b)) < e.size {
+		return nil, errInvalidCFB
+	}
+
+	return b[:e.size], nil
+}
+
+// children returns the indexes of the entries in the storage, by name
+func (f *cfbFile) children(storage int) map[string]int {
+	children := map[string]int{}
+	visited := map[uint32]bool{}
+
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if int(id) >= len(f.entries) || visited[id] {
+			return
+		}
+
+		visited[id] = true
+		e := f.entries[id]
+		walk(e.left)
+		children[e.name] = int(id)
+		walk(e.right)
+	}
+
+	walk(f.entries[storage].child)
+
+	return children
+}
+
+// readerSize returns the size of readers which know it, e.g. *bytes.Reader or *os.File
+func readerSize(r io.ReaderAt) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		if fi, err := r.Stat(); err == nil {
+			return fi.Size(), true
+		}
+	}
+
+	return 0, false
+}
+
+func uint32Slice(b []byte) []uint32 {
+	s := make([]uint32, len(b)/4)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+
+	return s
+}
@@ -0,0 +1,611 @@
+package parsemail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	// hashes used by CMS signatures
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Cryptographic Message Syntax (PKCS#7) as used by S/MIME, see RFC 5652
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	// oidEmailAddress is the email address in the subject of legacy certificates
+	oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAOAEP         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+var (
+	errInvalidCMS        = errors.New("invalid CMS data")
+	errCMSNoRecipient    = errors.New("no CMS recipient matches the decryption key")
+	errCMSNoSignerCert   = errors.New("signer certificate not found")
+	errCMSDigestMismatch = errors.New("message digest mismatch")
+)
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsEnvelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo cmsEncryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsKeyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type cmsEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type rsaOAEPParameters struct {
+	HashFunc pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// parseCMS decodes a ContentInfo, which may be BER encoded
+func parseCMS(data []byte) (ci cmsContentInfo, err error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return
+	}
+
+	if _, err = asn1.Unmarshal(der, &ci); err != nil {
+		return ci, errInvalidCMS
+	}
+
+	return
+}
+
+// cmsSigner is a signer of signed data and the result of the verification of its signature
+type cmsSigner struct {
+	certificate *x509.Certificate
+	signingTime time.Time
+	err         error
+}
+
+// verifySignedData checks the signatures of the signed data over the content, which is the encapsulated content unless
+// detached is set. The certificates must chain to the roots, or to the system roots when nil, and be valid at now, the
+// current time when zero, or at the signing time of the signature when atSigningTime is set.
+func verifySignedData(content asn1.RawValue, detached []byte, roots *x509.CertPool, now time.Time, atSigningTime bool) (data []byte, signers []cmsSigner, err error) {
+	var sd cmsSignedData
+	if _, err = asn1.Unmarshal(content.Bytes, &sd); err != nil {
+		return nil, nil, errInvalidCMS
+	}
+
+	data = detached
+	if data == nil {
+		data, err = cmsOctetString(sd.EncapContentInfo.Content)
+		if err != nil {
+			return
+		}
+	}
+
+	var certificates []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		// other certificate formats, e.g. attribute certificates, are skipped
+		for rest := sd.Certificates.Bytes; len(rest) > 0; {
+			var raw asn1.RawValue
+			if rest, err = asn1.Unmarshal(rest, &raw); err != nil {
+				return nil, nil, errInvalidCMS
+			}
+
+			if cert, err := x509.ParseCertificate(raw.FullBytes); err == nil {
+				certificates = append(certificates, cert)
+			}
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certificates {
+		intermediates.AddCert(cert)
+	}
+
+	for _, si := range sd.SignerInfos {
+		signer := cmsSigner{}
+		signer.certificate, signer.signingTime, signer.err = verifySignerInfo(si, data, certificates)
+		if signer.err == nil {
+			verifyTime := now
+			if atSigningTime && !signer.signingTime.IsZero() {
+				verifyTime = signer.signingTime
+			} else if verifyTime.IsZero() {
+				verifyTime = time.Now()
+			}
+
+			_, signer.err = signer.certificate.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				CurrentTime:   verifyTime,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+			})
+		}
+
+		signers = append(signers, signer)
+	}
+
+	return data, signers, nil
+}
+
+// verifySignerInfo checks the signature of a signer and returns its certificate and signing time
+func verifySignerInfo(si cmsSignerInfo, data []byte, certificates []*x509.Certificate) (cert *x509.Certificate, signingTime time.Time, err error) {
+	cert = findCMSCertificate(si.SID, certificates)
+	if cert == nil {
+		return nil, signingTime, errCMSNoSignerCert
+	}
+
+	hash, err := cmsHash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return
+	}
+
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	signed := data
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		// the signature covers the DER encoding of the attributes as a SET OF
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+
+		var attributes []cmsAttribute
+		if _, err = asn1.UnmarshalWithParams(signed, &attributes, "set"); err != nil {
+			return cert, signingTime, errInvalidCMS
+		}
+
+		var messageDigest []byte
+		for _, attribute := range attributes {
+			switch {
+			case attribute.Type.Equal(oidAttributeMessageDigest):
+				_, err = asn1.Unmarshal(attribute.Values.Bytes, &messageDigest)
+			case attribute.Type.Equal(oidAttributeSigningTime):
+				_, err = asn1.Unmarshal(attribute.Values.Bytes, &signingTime)
+			}
+
+			if err != nil {
+				return cert, signingTime, errInvalidCMS
+			}
+		}
+
+		if !bytes.Equal(messageDigest, digest) {
+			return cert, signingTime, errCMSDigestMismatch
+		}
+
+		h = hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, hash, digest, si.Signature)
+	case *ecdsa.PublicKey:
+		var sig ecdsaSignature
+		if _, err = asn1.Unmarshal(si.Signature, &sig); err != nil || sig.R == nil || sig.S == nil {
+			return cert, signingTime, errInvalidCMS
+		}
+
+		if !ecdsa.Verify(pub, digest, sig.R, sig.S) {
+			err = errors.New("ecdsa: verification error")
+		}
+	default:
+		err = fmt.Errorf("unsupported public key type: %T", pub)
+	}
+
+	if err == nil && !isCMSSignatureAlgorithm(si.SignatureAlgorithm.Algorithm) {
+		err = fmt.Errorf("unsupported signature algorithm: %v", si.SignatureAlgorithm.Algorithm)
+	}
+
+	return
+}
+
+// decryptEnvelopedData decrypts the content of enveloped data with the key, using the recipient info matching the
+// certificate or, without certificate, the first one the key decrypts
+func decryptEnvelopedData(content asn1.RawValue, cert *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	var ed cmsEnvelopedData
+	if _, err := asn1.Unmarshal(content.Bytes, &ed); err != nil {
+		return nil, errInvalidCMS
+	}
+
+	var contentKey []byte
+	for _, ri := range ed.RecipientInfos {
+		// only key transport recipients (a SEQUENCE, as opposed to the tagged choices) are supported
+		if ri.Class != asn1.ClassUniversal || ri.Tag != asn1.TagSequence {
+			continue
+		}
+
+		var ktri cmsKeyTransRecipientInfo
+		if _, err := asn1.Unmarshal(ri.FullBytes, &ktri); err != nil {
+			return nil, errInvalidCMS
+		}
+
+		if cert != nil && findCMSCertificate(ktri.RID, []*x509.Certificate{cert}) == nil {
+			continue
+		}
+
+		var opts crypto.DecrypterOpts
+		switch {
+		case ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAEncryption):
+		case ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAOAEP):
+			var params rsaOAEPParameters
+			hash := crypto.SHA1
+			if len(ktri.KeyEncryptionAlgorithm.Parameters.FullBytes) > 0 {
+				if _, err := asn1.Unmarshal(ktri.KeyEncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+					return nil, errInvalidCMS
+				}
+
+				if len(params.HashFunc.Algorithm) > 0 {
+					var err error
+					if hash, err = cmsHash(params.HashFunc.Algorithm); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			opts = &rsa.OAEPOptions{Hash: hash}
+		default:
+			return nil, fmt.Errorf("unsupported key encryption algorithm: %v", ktri.KeyEncryptionAlgorithm.Algorithm)
+		}
+
+		decrypted, err := key.Decrypt(rand.Reader, ktri.EncryptedKey, opts)
+		if err == nil {
+			contentKey = decrypted
+			break
+		}
+
+		if cert != nil {
+			return nil, err
+		}
+	}
+
+	if contentKey == nil {
+		return nil, errCMSNoRecipient
+	}
+
+	eci := ed.EncryptedContentInfo
+	encrypted, err := cmsOctetString(eci.EncryptedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	var block cipher.Block
+	switch algorithm := eci.ContentEncryptionAlgorithm.Algorithm; {
+	case algorithm.Equal(oidAES128CBC), algorithm.Equal(oidAES192CBC), algorithm.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(contentKey)
+	case algorithm.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(contentKey)
+	default:
+		return nil, fmt.Errorf("unsupported content encryption algorithm: %v", algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil || len(iv) != block.BlockSize() {
+		return nil, errInvalidCMS
+	}
+
+	if len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return nil, errInvalidCMS
+	}
+
+	decrypted := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errInvalidCMS
+	}
+
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, errInvalidCMS
+		}
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// findCMSCertificate returns the certificate identified by issuer and serial number or by subject key identifier
+func findCMSCertificate(id asn1.RawValue, certificates []*x509.Certificate) *x509.Certificate {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		for _, cert := range certificates {
+			if bytes.Equal(cert.SubjectKeyId, id.Bytes) {
+				return cert
+			}
+		}
+
+		return nil
+	}
+
+	var ias cmsIssuerAndSerial
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil || ias.Serial == nil {
+		return nil
+	}
+
+	for _, cert := range certificates {
+		if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.Serial) == 0 {
+			return cert
+		}
+	}
+
+	return nil
+}
+
+func cmsHash(algorithm asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case algorithm.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case algorithm.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case algorithm.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case algorithm.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+
+	return 0, fmt.Errorf("unsupported digest algorithm: %v", algorithm)
+}
+
+func isCMSSignatureAlgorithm(algorithm asn1.ObjectIdentifier) bool {
+	for _, oid := range []asn1.ObjectIdentifier{oidRSAEncryption, oidSHA1WithRSA, oidSHA256WithRSA, oidSHA384WithRSA,
+		oidSHA512WithRSA, oidECPublicKey, oidECDSAWithSHA1, oidECDSAWithSHA256, oidECDSAWithSHA384, oidECDSAWithSHA512} {
+		if algorithm.Equal(oid) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cmsOctetString returns the content of an OCTET STRING, which BER allows to split in segments
+func cmsOctetString(v asn1.RawValue) ([]byte, error) {
+	if !v.IsCompound {
+		if (v.Class == asn1.ClassUniversal && v.Tag == asn1.TagOctetString) || v.Class == asn1.ClassContextSpecific {
+			return v.Bytes, nil
+		}
+
+		return nil, errInvalidCMS
+	}
+
+	var data []byte
+	for rest := v.Bytes; len(rest) > 0; {
+		var segment asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &segment); err != nil {
+			return nil, errInvalidCMS
+		}
+
+		b, err := cmsOctetString(segment)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, b...)
+	}
+
+	return data, nil
+}
+
+// berToDER converts indefinite lengths and constructed OCTET STRINGs of BER encoded data, as produced by many S/MIME
+// implementations, to DER
+func berToDER(data []byte) ([]byte, error) {
+	out, rest, err := berElement(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, errInvalidCMS
+	}
+
+	return out, nil
+}
+
+func berElement(data []byte, depth int) (out []byte, rest []byte, err error) {
+	if depth > 64 || len(data) < 2 {
+		return nil, nil, errInvalidCMS
+	}
+
+	// identifier octets, with high tag numbers in the following bytes
+	i := 1
+	if data[0]&0x1F == 0x1F {
+		for i < len(data) && data[i]&0x80 != 0 {
+			i++
+		}
+
+		i++
+	}
+
+	if i >= len(data) {
+		return nil, nil, errInvalidCMS
+	}
+
+	tag := data[:i]
+	constructed := data[0]&0x20 != 0
+
+	length := int(data[i])
+	i++
+
+	indefinite := length == 0x80
+	if length > 0x80 {
+		n := length & 0x7F
+		if n > 4 || i+n > len(data) {
+			return nil, nil, errInvalidCMS
+		}
+
+		length = 0
+		for _, b := range data[i : i+n] {
+			length = length<<8 | int(b)
+		}
+
+		i += n
+	}
+
+	if indefinite && !constructed {
+		return nil, nil, errInvalidCMS
+	}
+
+	if !constructed {
+		if length < 0 || i+length > len(data) {
+			return nil, nil, errInvalidCMS
+		}
+
+		return derElement(tag, data[i:i+length]), data[i+length:], nil
+	}
+
+	var content []byte
+	body := data[i:]
+	if !indefinite {
+		if length < 0 || i+length > len(data) {
+			return nil, nil, errInvalidCMS
+		}
+
+		body = data[i : i+length]
+		rest = data[i+length:]
+	}
+
+	for {
+		if indefinite {
+			if len(body) < 2 {
+				return nil, nil, errInvalidCMS
+			}
+
+			if body[0] == 0 && body[1] == 0 {
+				rest = body[2:]
+				break
+			}
+		} else if len(body) == 0 {
+			break
+		}
+
+		var element []byte
+		if element, body, err = berElement(body, depth+1); err != nil {
+			return nil, nil, err
+		}
+
+		content = append(content, element...)
+	}
+
+	// a constructed OCTET STRING is the concatenation of its segments
+	if len(tag) == 1 && tag[0] == 0x24 {
+		var segments []byte
+		for b := content; len(b) > 0; {
+			var segment asn1.RawValue
+			if b, err = asn1.Unmarshal(b, &segment); err != nil {
+				return nil, nil, errInvalidCMS
+			}
+
+			segments = append(segments, segment.Bytes...)
+		}
+
+		return derElement([]byte{0x04}, segments), rest, nil
+	}
+
+	return derElement(tag, content), rest, nil
+}
+
+func derElement(tag []byte, content []byte) []byte {
+	out := append([]byte{}, tag...)
+
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xFFFF:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	case n <= 0xFFFFFF:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	return append(out, content...)
+}
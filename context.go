@@ -0,0 +1,24 @@
+package parsemail
+
+import (
+	"context"
+	"io"
+)
+
+// ParseContext parses an email message like Parse, returning ctx.Err() once the context is done. Cancellation is
+// checked before each read from r and between body parts, a read blocked in r is not interrupted.
+func ParseContext(ctx context.Context, r io.Reader) (email Email, err error) {
+	return Parser{}.ParseContext(ctx, r)
+}
+
+// ParseContext parses an email message like Parse, within the limits, returning ctx.Err() once the context is done
+func (p Parser) ParseContext(ctx context.Context, r io.Reader) (email Email, err error) {
+	s := &parseState{ctx: ctx, limits: p.Limits, handlers: p.Handlers}
+
+	email, err = s.parse(r)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return Email{}, ctxErr
+	}
+
+	return
+}
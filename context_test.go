@@ -0,0 +1,108 @@
+package parsemail
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// cancellingReader cancels the parsing once the given number of bytes has been read
+type cancellingReader struct {
+	r      io.Reader
+	after  int
+	read   int
+	cancel context.CancelFunc
+}
+
+func (cr *cancellingReader) Read(b []byte) (int, error) {
+	if len(b) > 1024 {
+		b = b[:1024]
+	}
+
+	n, err := cr.r.Read(b)
+	cr.read += n
+	if cr.read >= cr.after {
+		cr.cancel()
+	}
+
+	return n, err
+}
+
+func TestParseContext(t *testing.T) {
+	e, err := ParseContext(context.Background(), strings.NewReader(multipartRelatedExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := Parse(strings.NewReader(multipartRelatedExample))
+	if e.HTMLBody != expected.HTMLBody {
+		t.Errorf("Wrong html body. Expected: %s, Got: %s", expected.HTMLBody, e.HTMLBody)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseContext(ctx, strings.NewReader(multipartRelatedExample)); err != context.Canceled {
+		t.Errorf("Wrong error. Expected: %v, Got: %v", context.Canceled, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, err := (Parser{}).ParseContext(ctx, strings.NewReader(multipartRelatedExample)); err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Expected: %v, Got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestParseContextCancelledWhileParsing(t *testing.T) {
+	message := "From: alice@example.com\nContent-Type: multipart/mixed; boundary=\"b\"\n\n" +
+		strings.Repeat("--b\nContent-Type: application/octet-stream\nContent-Disposition: attachment; filename=\"a.bin\"\n\n"+
+			strings.Repeat("0123456789abcdef", 256)+"\n", 100) + "--b--\n"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &cancellingReader{r: strings.NewReader(message), after: 20000, cancel: cancel}
+	if _, err := ParseContext(ctx, r); err != context.Canceled {
+		t.Errorf("Wrong error. Expected: %v, Got: %v", context.Canceled, err)
+	}
+
+	if r.read >= len(message) {
+		t.Errorf("Expected the parsing to stop reading. Read %v of %v bytes", r.read, len(message))
+	}
+}
+
+// cancellingPGPProvider cancels the parsing once it has verified a signature
+type cancellingPGPProvider struct {
+	testPGPProvider
+	cancel context.CancelFunc
+}
+
+func (p cancellingPGPProvider) Verify(data []byte, signature []byte) []PGPSignature {
+	p.cancel()
+
+	return p.testPGPProvider.Verify(data, signature)
+}
+
+func TestParserContextVariants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := (Parser{}).ParseBytesContext(ctx, []byte(multipartRelatedExample)); err != context.Canceled {
+		t.Errorf("Wrong ParseBytesContext error. Expected: %v, Got: %v", context.Canceled, err)
+	}
+
+	if _, err := (Parser{}).ParsePGPContext(ctx, strings.NewReader(pgpEncryptedExample), testPGPProvider{}); err != context.Canceled {
+		t.Errorf("Wrong ParsePGPContext error. Expected: %v, Got: %v", context.Canceled, err)
+	}
+
+	if _, err := (Parser{}).ParseSMIMEContext(ctx, strings.NewReader(smimeEncryptedExample), smimeTestOptions(t)); err != context.Canceled {
+		t.Errorf("Wrong ParseSMIMEContext error. Expected: %v, Got: %v", context.Canceled, err)
+	}
+
+	// the encrypted block after the signed one isn't handed to the provider anymore
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := (Parser{}).ParsePGPContext(ctx, strings.NewReader(pgpInlineExample), cancellingPGPProvider{cancel: cancel}); err != context.Canceled {
+		t.Errorf("Wrong error after cancellation by the provider. Expected: %v, Got: %v", context.Canceled, err)
+	}
+}
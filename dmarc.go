@@ -0,0 +1,276 @@
+package parsemail
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxReportSize is the maximum size of a decompressed report. Report mailboxes accept mail from anyone, so archives
+// may be compression bombs.
+var maxReportSize int64 = 64 << 20
+
+var errReportTooLarge = errors.New("report exceeds the maximum size of decompressed reports")
+
+// DMARCReport with the contents of a RFC7489 DMARC aggregate report
+type DMARCReport struct {
+	Version         string               `xml:"version"`
+	ReportMetadata  DMARCReportMetadata  `xml:"report_metadata"`
+	PolicyPublished DMARCPolicyPublished `xml:"policy_published"`
+	Records         []DMARCRecord        `xml:"record"`
+}
+
+// DMARCReportMetadata with the reporting organization and the period the report covers (as unix timestamps)
+type DMARCReportMetadata struct {
+	OrgName          string   `xml:"org_name"`
+	Email            string   `xml:"email"`
+	ExtraContactInfo string   `xml:"extra_contact_info"`
+	ReportID         string   `xml:"report_id"`
+	DateRangeBegin   int64    `xml:"date_range>begin"`
+	DateRangeEnd     int64    `xml:"date_range>end"`
+	Errors           []string `xml:"error"`
+}
+
+// DMARCPolicyPublished with the DMARC policy of the domain as seen by the reporter
+type DMARCPolicyPublished struct {
+	Domain string `xml:"domain"`
+	ADKIM  string `xml:"adkim"`
+	ASPF   string `xml:"aspf"`
+	P      string `xml:"p"`
+	SP     string `xml:"sp"`
+	Pct    int    `xml:"pct"`
+	Fo     string `xml:"fo"`
+}
+
+// DMARCRecord with the evaluation and authentication results of messages from a single source
+type DMARCRecord struct {
+	SourceIP        string               `xml:"row>source_ip"`
+	Count           int                  `xml:"row>count"`
+	PolicyEvaluated DMARCPolicyEvaluated `xml:"row>policy_evaluated"`
+	HeaderFrom      string               `xml:"identifiers>header_from"`
+	EnvelopeFrom    string               `xml:"identifiers>envelope_from"`
+	EnvelopeTo      string               `xml:"identifiers>envelope_to"`
+	DKIM            []DMARCDKIMResult    `xml:"auth_results>dkim"`
+	SPF             []DMARCSPFResult     `xml:"auth_results>spf"`
+}
+
+// DMARCPolicyEvaluated with the applied disposition, DMARC aligned results and the reasons for policy overrides
+type DMARCPolicyEvaluated struct {
+	Disposition string                `xml:"disposition"`
+	DKIM        string                `xml:"dkim"`
+	SPF         string                `xml:"spf"`
+	Reasons     []DMARCOverrideReason `xml:"reason"`
+}
+
+// DMARCOverrideReason with the type of and comment on a policy override
+type DMARCOverrideReason struct {
+	Type    string `xml:"type"`
+	Comment string `xml:"comment"`
+}
+
+// DMARCDKIMResult with the result of a single DKIM signature verification
+type DMARCDKIMResult struct {
+	Domain      string `xml:"domain"`
+	Selector    string `xml:"selector"`
+	Result      string `xml:"result"`
+	HumanResult string `xml:"human_result"`
+}
+
+// DMARCSPFResult with the result of a SPF check
+type DMARCSPFResult struct {
+	Domain string `xml:"domain"`
+	Scope  string `xml:"scope"`
+	Result string `xml:"result"`
+}
+
+// TLSReport with the contents of a RFC8460 SMTP TLS report
+type TLSReport struct {
+	OrganizationName string            `json:"organization-name"`
+	DateRange        TLSReportRange    `json:"date-range"`
+	ContactInfo      string            `json:"contact-info"`
+	ReportID         string            `json:"report-id"`
+	Policies         []TLSReportPolicy `json:"policies"`
+}
+
+// TLSReportRange with the period the report covers
+type TLSReportRange struct {
+	StartDatetime time.Time `json:"start-datetime"`
+	EndDatetime   time.Time `json:"end-datetime"`
+}
+
+// TLSReportPolicy with the evaluated policy, the session counts and the details of failed sessions
+type TLSReportPolicy struct {
+	Policy         TLSPolicy          `json:"policy"`
+	Summary        TLSSummary         `json:"summary"`
+	FailureDetails []TLSFailureDetail `json:"failure-details"`
+}
+
+// TLSPolicy with the type (sts, tlsa or no-policy-found) and contents of the policy
+type TLSPolicy struct {
+	PolicyType   string   `json:"policy-type"`
+	PolicyString []string `json:"policy-string"`
+	PolicyDomain string   `json:"policy-domain"`
+	MXHost       []string `json:"mx-host"`
+}
+
+// TLSSummary with the number of successful and failed sessions
+type TLSSummary struct {
+	TotalSuccessfulSessionCount int64 `json:"total-successful-session-count"`
+	TotalFailureSessionCount    int64 `json:"total-failure-session-count"`
+}
+
+// TLSFailureDetail with the result type and the hosts involved in failed sessions
+type TLSFailureDetail struct {
+	ResultType            string `json:"result-type"`
+	SendingMTAIP          string `json:"sending-mta-ip"`
+	ReceivingMXHostname   string `json:"receiving-mx-hostname"`
+	ReceivingMXHelo       string `json:"receiving-mx-helo"`
+	ReceivingIP           string `json:"receiving-ip"`
+	FailedSessionCount    int64  `json:"failed-session-count"`
+	AdditionalInformation string `json:"additional-information"`
+	FailureReasonCode     string `json:"failure-reason-code"`
+}
+
+// ParseDMARCReport finds the DMARC aggregate report attached to the email (plain, gzip or zip compressed XML) and
+// decodes it
+func ParseDMARCReport(email Email) (*DMARCReport, error) {
+	var report *DMARCReport
+	err := findReport(email, '<', func(data []byte) error {
+		report = &DMARCReport{}
+		return xml.Unmarshal(data, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ParseTLSReport finds the SMTP TLS report attached to the email (plain or gzip compressed JSON) and decodes it
+func ParseTLSReport(email Email) (*TLSReport, error) {
+	var report *TLSReport
+	err := findReport(email, '{', func(data []byte) error {
+		report = &TLSReport{}
+		return json.Unmarshal(data, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// findReport decompresses the attachments and the content of the email and decodes the first report starting with
+// the given character. Candidates which fail to decompress or decode are skipped, the last error is returned when no
+// report decodes.
+func findReport(email Email, first byte, decode func(data []byte) error) error {
+	var candidates []io.Reader
+	for _, a := range email.Attachments {
+		candidates = append(candidates, a.Data)
+	}
+
+	candidates = append(candidates, email.Content)
+
+	err := fmt.Errorf("no report found in email")
+	for _, c := range candidates {
+		raw, readErr := readData(c)
+		if readErr != nil {
+			return readErr
+		}
+
+		found, decompressErr := decompressReport(raw, func(data []byte) bool {
+			data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\xef\xbb\xbf"))
+			if len(data) == 0 || data[0] != first {
+				return false
+			}
+
+			err = decode(data)
+
+			return err == nil
+		})
+		if found {
+			return nil
+		} else if decompressErr != nil {
+			err = decompressErr
+		}
+	}
+
+	return err
+}
+
+// decompressReport detects gzip and zip compressed data by its magic bytes and hands the decompressed data to found,
+// for zip archives each xml or json file until found reports the report was found
+func decompressReport(data []byte, found func(data []byte) bool) (bool, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return false, err
+		}
+		defer gr.Close()
+
+		b, err := readReport(gr)
+		if err != nil {
+			return false, err
+		}
+
+		return found(b), nil
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return false, err
+		}
+
+		err = fmt.Errorf("no report file in zip archive")
+		for _, f := range zr.File {
+			switch strings.ToLower(path.Ext(f.Name)) {
+			case ".xml", ".json":
+				rc, openErr := f.Open()
+				if openErr != nil {
+					err = openErr
+					continue
+				}
+
+				b, readErr := readReport(rc)
+				rc.Close()
+				if readErr != nil {
+					err = readErr
+					continue
+				}
+
+				if found(b) {
+					return true, nil
+				}
+
+				err = nil
+			}
+		}
+
+		return false, err
+	default:
+		return found(data), nil
+	}
+}
+
+// readReport reads a decompressed report, failing with errReportTooLarge beyond maxReportSize
+func readReport(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxReportSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > maxReportSize {
+		return nil, errReportTooLarge
+	}
+
+	return b, nil
+}
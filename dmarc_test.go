@@ -0,0 +1,292 @@
+package parsemail
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseDMARCReport(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	f, _ := zw.Create("google.com!example.com!1335571200!1335657599.xml")
+	f.Write([]byte(dmarcReportExample))
+	zw.Close()
+
+	var testData = map[int]struct {
+		mailData string
+	}{
+		1: {mailData: fmt.Sprintf(dmarcZipMailExample, base64.StdEncoding.EncodeToString(zipped.Bytes()))},
+		2: {mailData: fmt.Sprintf(dmarcGzipMailExample, base64.StdEncoding.EncodeToString(gzipBytes(dmarcReportExample)))},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		r, err := ParseDMARCReport(e)
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if r.ReportMetadata.OrgName != "google.com" || r.ReportMetadata.ReportID != "17898547185416289213" {
+			t.Errorf("[Test Case %v] Wrong report metadata. Got: %+v", index, r.ReportMetadata)
+		}
+
+		if r.ReportMetadata.DateRangeBegin != 1335571200 || r.ReportMetadata.DateRangeEnd != 1335657599 {
+			t.Errorf("[Test Case %v] Wrong date range. Got: %+v", index, r.ReportMetadata)
+		}
+
+		if r.PolicyPublished.Domain != "example.com" || r.PolicyPublished.P != "none" || r.PolicyPublished.Pct != 100 {
+			t.Errorf("[Test Case %v] Wrong policy published. Got: %+v", index, r.PolicyPublished)
+		}
+
+		if len(r.Records) != 1 {
+			t.Errorf("[Test Case %v] Incorrect number of records! Expected: 1, Got: %v.", index, len(r.Records))
+			continue
+		}
+
+		rec := r.Records[0]
+		if rec.SourceIP != "192.0.2.1" || rec.Count != 2 || rec.PolicyEvaluated.DKIM != "pass" || rec.HeaderFrom != "example.com" {
+			t.Errorf("[Test Case %v] Wrong record. Got: %+v", index, rec)
+		}
+
+		if len(rec.DKIM) != 1 || rec.DKIM[0].Selector != "s1" || len(rec.SPF) != 1 || rec.SPF[0].Result != "fail" {
+			t.Errorf("[Test Case %v] Wrong auth results. Got: %+v %+v", index, rec.DKIM, rec.SPF)
+		}
+	}
+
+	if _, err := ParseDMARCReport(Email{}); err == nil {
+		t.Error("Expected error for email without report")
+	}
+}
+
+func TestParseTLSReport(t *testing.T) {
+	e, err := Parse(strings.NewReader(fmt.Sprintf(tlsReportMailExample, base64.StdEncoding.EncodeToString(gzipBytes(tlsReportExample)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ParseTLSReport(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.OrganizationName != "Company-X" || r.ReportID != "5065427c-23d3-47ca-b6e0-946ea0e8c4be" {
+		t.Errorf("Wrong report. Got: %+v", r)
+	}
+
+	if !r.DateRange.StartDatetime.Equal(parseDate("Tue, 29 May 2018 00:00:00 +0000")) {
+		t.Errorf("Wrong date range. Got: %+v", r.DateRange)
+	}
+
+	if len(r.Policies) != 1 {
+		t.Fatalf("Incorrect number of policies! Expected: 1, Got: %v.", len(r.Policies))
+	}
+
+	p := r.Policies[0]
+	if p.Policy.PolicyType != "sts" || p.Summary.TotalSuccessfulSessionCount != 5326 || p.Summary.TotalFailureSessionCount != 303 {
+		t.Errorf("Wrong policy. Got: %+v", p)
+	}
+
+	if len(p.FailureDetails) != 1 || p.FailureDetails[0].ResultType != "certificate-expired" || p.FailureDetails[0].FailedSessionCount != 100 {
+		t.Errorf("Wrong failure details. Got: %+v", p.FailureDetails)
+	}
+}
+
+func TestParseDMARCReportSkipsInvalidReports(t *testing.T) {
+	invalid := strings.Replace(dmarcReportExample, "<begin>1335571200</begin>", "<begin>yesterday</begin>", 1)
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	f, _ := zw.Create("invalid.xml")
+	f.Write([]byte(invalid))
+	f, _ = zw.Create("valid.xml")
+	f.Write([]byte(dmarcReportExample))
+	zw.Close()
+
+	var testData = map[int]struct {
+		attachments [][]byte
+	}{
+		1: {attachments: [][]byte{[]byte(invalid), gzipBytes(dmarcReportExample)}},
+		2: {attachments: [][]byte{zipped.Bytes()}},
+	}
+
+	for index, td := range testData {
+		e := Email{}
+		for _, a := range td.attachments {
+			e.Attachments = append(e.Attachments, Attachment{Data: bytes.NewReader(a)})
+		}
+
+		r, err := ParseDMARCReport(e)
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if r.ReportMetadata.DateRangeBegin != 1335571200 {
+			t.Errorf("[Test Case %v] Wrong date range. Got: %+v", index, r.ReportMetadata)
+		}
+	}
+
+	e := Email{Attachments: []Attachment{{Data: bytes.NewReader([]byte(invalid))}}}
+	if _, err := ParseDMARCReport(e); err == nil || err.Error() == "no report found in email" {
+		t.Errorf("Expected the decoding error of the invalid report. Got: %v", err)
+	}
+}
+
+func TestParseDMARCReportTooLarge(t *testing.T) {
+	defer func(size int64) { maxReportSize = size }(maxReportSize)
+	maxReportSize = 1 << 10
+
+	bomb := gzipBytes("<" + strings.Repeat(" ", 1<<20))
+
+	e := Email{Attachments: []Attachment{{Data: bytes.NewReader(bomb)}}}
+	if _, err := ParseDMARCReport(e); err != errReportTooLarge {
+		t.Errorf("Wrong error. Expected: %v, Got: %v", errReportTooLarge, err)
+	}
+}
+
+func gzipBytes(s string) []byte {
+	var b bytes.Buffer
+	gw := gzip.NewWriter(&b)
+	gw.Write([]byte(s))
+	gw.Close()
+
+	return b.Bytes()
+}
+
+var dmarcZipMailExample = `From: noreply-dmarc-support@google.com
+To: dmarc@example.com
+Subject: Report domain: example.com Submitter: google.com Report-ID: 17898547185416289213
+Date: Sun, 29 Apr 2012 12:00:00 +0000
+Content-Type: multipart/mixed; boundary="000000000000a1b2c3"
+
+--000000000000a1b2c3
+Content-Type: text/plain; charset="UTF-8"
+
+This is an aggregate report from google.com.
+--000000000000a1b2c3
+Content-Type: application/zip; name="google.com!example.com!1335571200!1335657599.zip"
+Content-Disposition: attachment; filename="google.com!example.com!1335571200!1335657599.zip"
+Content-Transfer-Encoding: base64
+
+%s
+--000000000000a1b2c3--
+`
+
+var dmarcGzipMailExample = `From: dmarc@yahoo.com
+To: dmarc@example.com
+Subject: Report Domain: example.com Submitter: yahoo.com
+Date: Sun, 29 Apr 2012 12:00:00 +0000
+Content-Type: application/gzip; name="yahoo.com!example.com!1335571200!1335657599.xml.gz"
+Content-Disposition: attachment; filename="yahoo.com!example.com!1335571200!1335657599.xml.gz"
+Content-Transfer-Encoding: base64
+
+%s`
+
+var tlsReportMailExample = `From: tls-reporting@company-x.example
+To: tlsrpt@example.com
+Subject: Report Domain: example.com Submitter: company-x.example Report-ID: <5065427c-23d3-47ca-b6e0-946ea0e8c4be>
+Date: Wed, 30 May 2018 12:00:00 +0000
+TLS-Report-Domain: example.com
+TLS-Report-Submitter: company-x.example
+Content-Type: multipart/report; report-type="tlsrpt"; boundary="----=_NextPart_000_024E_01CC9B0A.AFE54C00"
+
+------=_NextPart_000_024E_01CC9B0A.AFE54C00
+Content-Type: text/plain; charset="us-ascii"
+
+This is an aggregate TLS report from company-x.example
+------=_NextPart_000_024E_01CC9B0A.AFE54C00
+Content-Type: application/tlsrpt+gzip
+Content-Disposition: attachment; filename="company-x.example!example.com!1527552000!1527638400.json.gz"
+Content-Transfer-Encoding: base64
+
+%s
+------=_NextPart_000_024E_01CC9B0A.AFE54C00--
+`
+
+var dmarcReportExample = `<?xml version="1.0" encoding="UTF-8" ?>
+<feedback>
+  <report_metadata>
+    <org_name>google.com</org_name>
+    <email>noreply-dmarc-support@google.com</email>
+    <report_id>17898547185416289213</report_id>
+    <date_range>
+      <begin>1335571200</begin>
+      <end>1335657599</end>
+    </date_range>
+  </report_metadata>
+  <policy_published>
+    <domain>example.com</domain>
+    <adkim>r</adkim>
+    <aspf>r</aspf>
+    <p>none</p>
+    <sp>none</sp>
+    <pct>100</pct>
+  </policy_published>
+  <record>
+    <row>
+      <source_ip>192.0.2.1</source_ip>
+      <count>2</count>
+      <policy_evaluated>
+        <disposition>none</disposition>
+        <dkim>pass</dkim>
+        <spf>fail</spf>
+      </policy_evaluated>
+    </row>
+    <identifiers>
+      <header_from>example.com</header_from>
+    </identifiers>
+    <auth_results>
+      <dkim>
+        <domain>example.com</domain>
+        <selector>s1</selector>
+        <result>pass</result>
+      </dkim>
+      <spf>
+        <domain>example.com</domain>
+        <result>fail</result>
+      </spf>
+    </auth_results>
+  </record>
+</feedback>
+`
+
+// example from RFC8460 appendix B
+var tlsReportExample = `{
+  "organization-name": "Company-X",
+  "date-range": {
+    "start-datetime": "2018-05-29T00:00:00Z",
+    "end-datetime": "2018-05-29T23:59:59Z"
+  },
+  "contact-info": "sts-reporting@company-x.example",
+  "report-id": "5065427c-23d3-47ca-b6e0-946ea0e8c4be",
+  "policies": [{
+    "policy": {
+      "policy-type": "sts",
+      "policy-string": ["version: STSv1","mode: testing",
+            "mx: *.mail.company-y.example","max_age: 86400"],
+      "policy-domain": "company-y.example",
+      "mx-host": ["*.mail.company-y.example"]
+    },
+    "summary": {
+      "total-successful-session-count": 5326,
+      "total-failure-session-count": 303
+    },
+    "failure-details": [{
+      "result-type": "certificate-expired",
+      "sending-mta-ip": "2001:db8:abcd:0012::1",
+      "receiving-mx-hostname": "mx1.mail.company-y.example",
+      "failed-session-count": 100
+    }]
+  }]
+}`
@@ -0,0 +1,238 @@
+package parsemail
+
+import (
+	"bufio"
+	"bytes"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const reportTypeDeliveryStatus = "delivery-status"
+
+// reportPart is a machine readable part of a multipart/report message, or the returned original message
+type reportPart struct {
+	contentType string
+	data        []byte
+}
+
+// DeliveryStatus with the per-message fields of a RFC3464 delivery status notification, its per-recipient
+// fields and the headers of the returned original message (if any)
+type DeliveryStatus struct {
+	ReportingMTA       string
+	OriginalEnvelopeID string
+	ReceivedFromMTA    string
+	ArrivalDate        time.Time
+
+	Recipients []RecipientStatus
+
+	OriginalHeader mail.Header
+
+	// Heuristic is set when the status was guessed from the text of a non-standard bounce
+	Heuristic bool
+}
+
+// RecipientStatus with the per-recipient fields of a delivery status notification. Address and MTA fields are
+// stripped of their type prefix (e.g. "rfc822;" or "dns;").
+type RecipientStatus struct {
+	OriginalRecipient string
+	FinalRecipient    string
+	Action            string
+	Status            string
+	RemoteMTA         string
+	DiagnosticCode    string
+	LastAttemptDate   time.Time
+	WillRetryUntil    time.Time
+}
+
+func parseDeliveryStatus(reports []reportPart) (ds *DeliveryStatus) {
+	for _, r := range reports {
+		switch r.contentType {
+		case "message/delivery-status", "message/global-delivery-status":
+			groups := readFieldGroups(r.data)
+
+			if ds == nil {
+				ds = &DeliveryStatus{}
+			}
+
+			hp := headerParser{}
+			for i, g := range groups {
+				if i == 0 {
+					ds.ReportingMTA = stripFieldType(g.Get("Reporting-MTA"))
+					ds.OriginalEnvelopeID = g.Get("Original-Envelope-Id")
+					ds.ReceivedFromMTA = stripFieldType(g.Get("Received-From-MTA"))
+					ds.ArrivalDate = hp.parseTime(g.Get("Arrival-Date"))
+					continue
+				}
+
+				if g == nil {
+					continue
+				}
+
+				ds.Recipients = append(ds.Recipients, RecipientStatus{
+					OriginalRecipient: stripFieldType(g.Get("Original-Recipient")),
+					FinalRecipient:    stripFieldType(g.Get("Final-Recipient")),
+					Action:            strings.ToLower(g.Get("Action")),
+					Status:            g.Get("Status"),
+					RemoteMTA:         stripFieldType(g.Get("Remote-MTA")),
+					DiagnosticCode:    stripFieldType(g.Get("Diagnostic-Code")),
+					LastAttemptDate:   hp.parseTime(g.Get("Last-Attempt-Date")),
+					WillRetryUntil:    hp.parseTime(g.Get("Will-Retry-Until")),
+				})
+			}
+		}
+	}
+
+	if ds == nil {
+		return
+	}
+
+	ds.OriginalHeader = parseReturnedHeader(reports)
+
+	return
+}
+
+// parseReturnedHeader reads the header of the returned original message of a report, if there is one. Malformed
+// headers are skipped, the report is still useful without them.
+func parseReturnedHeader(reports []reportPart) mail.Header {
+	for _, r := range reports {
+		switch r.contentType {
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			msg, err := mail.ReadMessage(bytes.NewReader(append(r.data, '\n')))
+			if err != nil {
+				continue
+			}
+
+			header, err := decodeHeaderMime(msg.Header)
+			if err != nil {
+				continue
+			}
+
+			return header
+		}
+	}
+
+	return nil
+}
+
+// readFieldGroups splits a machine readable report body into its blank line separated groups of header fields.
+// Malformed groups are nil, so the groups that did parse keep their position.
+func readFieldGroups(data []byte) (groups []textproto.MIMEHeader) {
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+
+	for _, block := range strings.Split(string(data), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+
+		tp := textproto.NewReader(bufio.NewReader(strings.NewReader(strings.TrimLeft(block, "\n") + "\n\n")))
+		h, err := tp.ReadMIMEHeader()
+		if err != nil {
+			h = nil
+		}
+
+		groups = append(groups, h)
+	}
+
+	return
+}
+
+func stripFieldType(s string) string {
+	if i := strings.Index(s, ";"); i != -1 {
+		return strings.TrimSpace(s[i+1:])
+	}
+
+	return strings.TrimSpace(s)
+}
+
+var bounceSenderRe = regexp.MustCompile(`(?i)^(mailer-daemon|postmaster|mail-daemon|mail\.delivery\.subsystem|microsoftexchange[0-9a-f]*)@`)
+var bounceSubjectRe = regexp.MustCompile(`(?i)(undeliver|undelivered mail|delivery status notification|delivery failure|mail delivery failed|failure notice|returned mail|delivery has failed|could not be delivered|message not delivered)`)
+var bounceRecipientLineRe = regexp.MustCompile(`^\s*<?([A-Za-z0-9._%+\-=']+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})>?:?\s*$`)
+var bounceRecipientSentenceRe = regexp.MustCompile(`(?i)(?:wasn't delivered to|was not delivered to|delivery to|could not be delivered to|failed to deliver to|undeliverable to)\s+<?([A-Za-z0-9._%+\-=']+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})>?`)
+var bounceEnhancedStatusRe = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+var bounceSMTPCodeRe = regexp.MustCompile(`\b([245]\d\d)[ \-]`)
+var bounceDelayRe = regexp.MustCompile(`(?i)(delayed|will retry|will be retried|still trying|not yet been delivered)`)
+
+// isBounce reports whether a message without a delivery-status report looks like a non-standard bounce
+func isBounce(email Email) bool {
+	fromDaemon := false
+	for _, a := range email.From {
+		if bounceSenderRe.MatchString(a.Address) {
+			fromDaemon = true
+		}
+	}
+
+	return fromDaemon && bounceSubjectRe.MatchString(email.Subject)
+}
+
+// guessDeliveryStatus extracts the failed recipients and diagnostics from the text of non-standard bounces as
+// sent by qmail, Exim and the large mailbox providers. It returns nil if no recipient could be found.
+func guessDeliveryStatus(email Email) *DeliveryStatus {
+	var recipients []RecipientStatus
+
+	action := "failed"
+	if bounceDelayRe.MatchString(email.Subject) || bounceDelayRe.MatchString(email.TextBody) {
+		action = "delayed"
+	}
+
+	for _, line := range strings.Split(email.TextBody, "\n") {
+		address := ""
+		if m := bounceRecipientLineRe.FindStringSubmatch(line); m != nil {
+			address = m[1]
+		} else if m := bounceRecipientSentenceRe.FindStringSubmatch(line); m != nil {
+			address = m[1]
+		}
+
+		if address != "" && !isOwnAddress(email, address) {
+			recipients = append(recipients, RecipientStatus{FinalRecipient: address, Action: action})
+		}
+
+		if len(recipients) == 0 {
+			continue
+		}
+
+		current := &recipients[len(recipients)-1]
+		trimmed := strings.TrimSpace(line)
+		if current.Status == "" {
+			if m := bounceEnhancedStatusRe.FindStringSubmatch(trimmed); m != nil {
+				current.Status = m[1]
+			}
+		}
+
+		if current.DiagnosticCode == "" && bounceSMTPCodeRe.MatchString(trimmed+" ") {
+			current.DiagnosticCode = trimmed
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	for i := range recipients {
+		if recipients[i].Status == "" {
+			if m := bounceSMTPCodeRe.FindStringSubmatch(recipients[i].DiagnosticCode + " "); m != nil {
+				recipients[i].Status = m[1][:1] + ".0.0"
+			} else if action == "delayed" {
+				recipients[i].Status = "4.0.0"
+			} else {
+				recipients[i].Status = "5.0.0"
+			}
+		}
+	}
+
+	return &DeliveryStatus{Recipients: recipients, Heuristic: true}
+}
+
+func isOwnAddress(email Email, address string) bool {
+	for _, list := range [][]*mail.Address{email.From, email.To, email.Cc} {
+		for _, a := range list {
+			if strings.EqualFold(a.Address, address) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
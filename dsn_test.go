@@ -0,0 +1,211 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDeliveryStatus(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+
+		textBody       string
+		reportingMTA   string
+		arrivalDate    string
+		heuristic      bool
+		recipients     []RecipientStatus
+		originalHeader map[string]string
+	}{
+		1: {
+			mailData:     dsnExample,
+			textBody:     "This is an automatically generated Delivery Status Notification.\n\nDelivery to the following recipients failed permanently:\n\n     nobody@example.org",
+			reportingMTA: "mx.example.com",
+			arrivalDate:  "Fri, 21 Nov 1997 09:55:06 -0600",
+			recipients: []RecipientStatus{
+				{
+					OriginalRecipient: "nobody@example.org",
+					FinalRecipient:    "nobody@example.org",
+					Action:            "failed",
+					Status:            "5.1.1",
+					RemoteMTA:         "mail.example.org",
+					DiagnosticCode:    "550 5.1.1 User unknown",
+				},
+				{
+					FinalRecipient: "slow@example.net",
+					Action:         "delayed",
+					Status:         "4.4.7",
+				},
+			},
+			originalHeader: map[string]string{
+				"Subject":    "Saying Hello",
+				"Message-Id": "<1234@local.machine.example>",
+			},
+		},
+		2: {
+			mailData:  qmailBounceExample,
+			heuristic: true,
+			recipients: []RecipientStatus{
+				{
+					FinalRecipient: "nobody@example.org",
+					Action:         "failed",
+					Status:         "5.1.1",
+					DiagnosticCode: "Remote host said: 550 5.1.1 User unknown",
+				},
+			},
+		},
+		3: {
+			mailData:     malformedDSNExample,
+			reportingMTA: "mx.example.com",
+			recipients: []RecipientStatus{
+				{
+					FinalRecipient: "slow@example.net",
+					Action:         "delayed",
+					Status:         "4.4.7",
+				},
+			},
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if td.textBody != "" && td.textBody != e.TextBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: '%s', Got: '%s'", index, td.textBody, e.TextBody)
+		}
+
+		ds := e.DeliveryStatus
+		if ds == nil {
+			t.Errorf("[Test Case %v] Missing delivery status", index)
+			continue
+		}
+
+		if td.reportingMTA != ds.ReportingMTA {
+			t.Errorf("[Test Case %v] Wrong reporting MTA. Expected: %s, Got: %s", index, td.reportingMTA, ds.ReportingMTA)
+		}
+
+		if td.arrivalDate != "" && !parseDate(td.arrivalDate).Equal(ds.ArrivalDate) {
+			t.Errorf("[Test Case %v] Wrong arrival date. Expected: %s, Got: %v", index, td.arrivalDate, ds.ArrivalDate)
+		}
+
+		if td.heuristic != ds.Heuristic {
+			t.Errorf("[Test Case %v] Wrong heuristic flag. Expected: %v, Got: %v", index, td.heuristic, ds.Heuristic)
+		}
+
+		if len(td.recipients) != len(ds.Recipients) {
+			t.Errorf("[Test Case %v] Incorrect number of recipients! Expected: %v, Got: %v.", index, len(td.recipients), len(ds.Recipients))
+		} else {
+			for i := range td.recipients {
+				if td.recipients[i] != ds.Recipients[i] {
+					t.Errorf("[Test Case %v] Wrong recipient %v. Expected: %+v, Got: %+v", index, i, td.recipients[i], ds.Recipients[i])
+				}
+			}
+		}
+
+		if td.originalHeader == nil && ds.OriginalHeader != nil {
+			t.Errorf("[Test Case %v] Unexpected original header: %v", index, ds.OriginalHeader)
+		}
+
+		for k, v := range td.originalHeader {
+			if ds.OriginalHeader.Get(k) != v {
+				t.Errorf("[Test Case %v] Wrong original header %s. Expected: %s, Got: %s", index, k, v, ds.OriginalHeader.Get(k))
+			}
+		}
+	}
+}
+
+var dsnExample = `From: Mail Delivery Subsystem <mailer-daemon@example.com>
+To: jdoe@machine.example
+Subject: Delivery Status Notification (Failure)
+Date: Fri, 21 Nov 1997 10:00:00 -0600
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="RAA14128.773615765/mx.example.com"
+
+--RAA14128.773615765/mx.example.com
+Content-Type: text/plain; charset=UTF-8
+
+This is an automatically generated Delivery Status Notification.
+
+Delivery to the following recipients failed permanently:
+
+     nobody@example.org
+
+--RAA14128.773615765/mx.example.com
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.com
+Arrival-Date: Fri, 21 Nov 1997 09:55:06 -0600
+
+Original-Recipient: rfc822;nobody@example.org
+Final-Recipient: rfc822;nobody@example.org
+Action: failed
+Status: 5.1.1
+Remote-MTA: dns; mail.example.org
+Diagnostic-Code: smtp; 550 5.1.1 User unknown
+
+Final-Recipient: rfc822; slow@example.net
+Action: Delayed
+Status: 4.4.7
+
+--RAA14128.773615765/mx.example.com
+Content-Type: text/rfc822-headers
+
+From: John Doe <jdoe@machine.example>
+To: nobody@example.org
+Subject: Saying Hello
+Date: Fri, 21 Nov 1997 09:55:06 -0600
+Message-ID: <1234@local.machine.example>
+
+--RAA14128.773615765/mx.example.com--
+`
+
+var malformedDSNExample = `From: Mail Delivery Subsystem <mailer-daemon@example.com>
+To: jdoe@machine.example
+Subject: Delivery Status Notification (Failure)
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="boundary"
+
+--boundary
+Content-Type: text/plain; charset=UTF-8
+
+Delivery failed.
+
+--boundary
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.com
+
+Final-Recipient: rfc822;nobody@example.org
+this line is not a field
+Action: failed
+
+Final-Recipient: rfc822; slow@example.net
+Action: Delayed
+Status: 4.4.7
+
+--boundary
+Content-Type: text/rfc822-headers
+
+this line is not a field either
+Subject: Saying Hello
+
+--boundary--
+`
+
+var qmailBounceExample = `From: MAILER-DAEMON@mx.example.com
+To: jdoe@machine.example
+Subject: failure notice
+Date: Fri, 21 Nov 1997 10:00:00 -0600
+
+Hi. This is the qmail-send program at mx.example.com.
+I'm afraid I wasn't able to deliver your message to the following addresses.
+This is a permanent error; I've given up. Sorry it didn't work out.
+
+<nobody@example.org>:
+192.0.2.1 does not like recipient.
+Remote host said: 550 5.1.1 User unknown
+Giving up on 192.0.2.1.
+`
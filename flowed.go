@@ -0,0 +1,117 @@
+package parsemail
+
+import (
+	"strings"
+)
+
+const flowedLineLength = 78
+
+// decodeTextBody unwraps text/plain bodies sent with format=flowed
+func decodeTextBody(body string, params map[string]string) string {
+	if strings.EqualFold(params["format"], "flowed") {
+		return DecodeFlowed(body, strings.EqualFold(params["delsp"], "yes"))
+	}
+
+	return body
+}
+
+// DecodeFlowed unwraps RFC3676 format=flowed text. Soft line breaks are removed, joining the lines of a paragraph
+// into one, and space-stuffing is undone. Quoted paragraphs are prefixed with one ">" per quote level followed by
+// a space. If delSp is set (delsp=yes), the space before each soft line break is removed as well.
+func DecodeFlowed(text string, delSp bool) string {
+	var b strings.Builder
+
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	flowing := false
+	depth := 0
+
+	for i, line := range lines {
+		d := 0
+		for d < len(line) && line[d] == '>' {
+			d++
+		}
+
+		content := strings.TrimPrefix(line[d:], " ")
+		flowed := strings.HasSuffix(content, " ") && content != "-- "
+		if flowed && delSp {
+			content = content[:len(content)-1]
+		}
+
+		if flowing && d == depth {
+			b.WriteString(content)
+		} else {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+
+			b.WriteString(strings.Repeat(">", d))
+			if d > 0 && content != "" {
+				b.WriteString(" ")
+			}
+
+			b.WriteString(content)
+		}
+
+		flowing = flowed
+		depth = d
+	}
+
+	return b.String()
+}
+
+// EncodeFlowed wraps text into RFC3676 format=flowed lines of at most 78 characters (where possible) for sending
+// with "Content-Type: text/plain; format=flowed". Lines of the text are paragraphs; lines starting with ">" are
+// quoted at the level given by the number of ">" characters.
+func EncodeFlowed(text string) string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		d := 0
+		for d < len(paragraph) && paragraph[d] == '>' {
+			d++
+		}
+
+		prefix := strings.Repeat(">", d)
+		content := paragraph[d:]
+		if d > 0 {
+			content = strings.TrimPrefix(content, " ")
+		}
+
+		if content != "-- " {
+			content = strings.TrimRight(content, " ")
+		}
+
+		width := flowedLineLength - len(prefix) - 1
+		for len(content) > width {
+			i := strings.LastIndex(content[:width], " ")
+			if i <= 0 {
+				i = strings.Index(content[width:], " ")
+				if i == -1 {
+					break
+				}
+
+				i += width
+			}
+
+			lines = append(lines, prefix+spaceStuff(content[:i+1], d))
+			content = content[i+1:]
+		}
+
+		lines = append(lines, prefix+spaceStuff(content, d))
+	}
+
+	return strings.Join(lines, "\r\n")
+}
+
+// spaceStuff prefixes lines that would otherwise be mistaken for quotes or wrongly unstuffed with a space
+func spaceStuff(line string, depth int) string {
+	if line == "" {
+		return line
+	}
+
+	if depth > 0 || strings.HasPrefix(line, " ") || strings.HasPrefix(line, ">") || strings.HasPrefix(line, "From ") {
+		return " " + line
+	}
+
+	return line
+}
@@ -0,0 +1,71 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeFlowed(t *testing.T) {
+	var testData = map[int]struct {
+		text   string
+		delSp  bool
+		result string
+	}{
+		1: {
+			text:   "This is a long \r\nparagraph that was \r\nwrapped.\r\nNext line.",
+			result: "This is a long paragraph that was wrapped.\nNext line.",
+		},
+		2: {
+			text:   "> Quoted text \r\n> continues here.\r\n>> Deeper \r\n>>quote\r\n>\r\nReply",
+			result: "> Quoted text continues here.\n>> Deeper quote\n>\nReply",
+		},
+		3: {
+			text:   " From the start and >stuffed \r\n >lines\r\n-- \r\nSignature",
+			result: "From the start and >stuffed >lines\n-- \nSignature",
+		},
+		4: {
+			text:   "Japanese text is joined \r\nwithout spaces",
+			delSp:  true,
+			result: "Japanese text is joinedwithout spaces",
+		},
+	}
+
+	for index, td := range testData {
+		result := DecodeFlowed(td.text, td.delSp)
+		if td.result != result {
+			t.Errorf("[Test Case %v] Wrong result. Expected: '%s', Got: '%s'", index, td.result, result)
+		}
+	}
+}
+
+func TestEncodeFlowed(t *testing.T) {
+	text := strings.Repeat("lorem ipsum dolor sit amet ", 10) + "end\n> " + strings.Repeat("quoted words ", 10) + "\n\nFrom me\n-- \nSig"
+
+	encoded := EncodeFlowed(text)
+	for _, line := range strings.Split(encoded, "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("Line too long: '%s'", line)
+		}
+	}
+
+	if !strings.Contains(encoded, "\r\n From me\r\n-- \r\nSig") {
+		t.Errorf("Wrong space-stuffing or signature. Got: '%s'", encoded)
+	}
+
+	expected := strings.Repeat("lorem ipsum dolor sit amet ", 10) + "end\n> " + strings.TrimSpace(strings.Repeat("quoted words ", 10)) + "\n\nFrom me\n-- \nSig"
+	if decoded := DecodeFlowed(encoded, false); decoded != expected {
+		t.Errorf("Wrong round trip. Expected: '%s', Got: '%s'", expected, decoded)
+	}
+}
+
+func TestParseFlowed(t *testing.T) {
+	e, err := Parse(strings.NewReader("From: John Doe <jdoe@machine.example>\nDate: Fri, 21 Nov 1997 09:55:06 -0600\n" +
+		"Content-Type: text/plain; charset=utf-8; format=flowed; delsp=no\n\nHello \nworld.\n> quoted \n> text\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.TextBody != "Hello world.\n> quoted text" {
+		t.Errorf("Wrong text body. Got: '%s'", e.TextBody)
+	}
+}
@@ -0,0 +1,138 @@
+package parsemail
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Part is a body part of a multipart body handed to a ContentHandler
+type Part struct {
+	Header textproto.MIMEHeader
+	// ContentType is the lower case media type, e.g. application/json
+	ContentType string
+	Params      map[string]string
+	// FileName is the decoded filename of the Content-Disposition
+	FileName string
+	// Body with the content transfer encoding decoded
+	Body io.Reader
+}
+
+// ContentHandler processes a body part, contributing to the email, e.g. by setting its bodies or appending
+// attachments. Returning an error fails the parsing.
+type ContentHandler func(part Part, email *Email) error
+
+// ContentHandlers maps media types to the handlers of the body parts of that type. Handlers registered for
+// wildcards, type/* for all subtypes of the type or */* for all media types, are used when there is no handler for
+// the media type itself, except for the media types the package parses itself: text/plain, text/html, text/calendar,
+// vCards and multipart bodies. Handlers take precedence over the built-in processing of the parts.
+type ContentHandlers struct {
+	mu       sync.RWMutex
+	handlers map[string]ContentHandler
+}
+
+// DefaultContentHandlers are used by Parse and by parsers without content handlers
+var DefaultContentHandlers = &ContentHandlers{}
+
+// RegisterContentHandler registers the handler for the media type in DefaultContentHandlers
+func RegisterContentHandler(mediaType string, handler ContentHandler) {
+	DefaultContentHandlers.Register(mediaType, handler)
+}
+
+// Register registers the handler for the media type, e.g. text/markdown, text/* or */*, replacing the handler
+// registered before. A nil handler removes the handler of the media type.
+func (h *ContentHandlers) Register(mediaType string, handler ContentHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if handler == nil {
+		delete(h.handlers, mediaType)
+		return
+	}
+
+	if h.handlers == nil {
+		h.handlers = map[string]ContentHandler{}
+	}
+
+	h.handlers[mediaType] = handler
+}
+
+// lookup returns the handler for the media type, falling back to the wildcards
+func (h *ContentHandlers) lookup(mediaType string) ContentHandler {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if handler, ok := h.handlers[mediaType]; ok {
+		return handler
+	}
+
+	if isBuiltinMediaType(mediaType) {
+		return nil
+	}
+
+	if i := strings.Index(mediaType, "/"); i >= 0 {
+		if handler, ok := h.handlers[mediaType[:i]+"/*"]; ok {
+			return handler
+		}
+	}
+
+	return h.handlers["*/*"]
+}
+
+// isBuiltinMediaType reports whether the package parses bodies of the media type itself, rather than only keeping
+// them as attachments or Content
+func isBuiltinMediaType(mediaType string) bool {
+	switch mediaType {
+	case contentTypeTextPlain, contentTypeTextHtml, contentTypeTextCalendar, contentTypeTextVCard, contentTypeTextXVCard:
+		return true
+	}
+
+	return strings.HasPrefix(mediaType, "multipart/")
+}
+
+// handlePart hands the part to the handler registered for its media type. handled is false when there is none.
+func (s *parseState) handlePart(part *multipart.Part, contentType string, params map[string]string, email *Email) (handled bool, err error) {
+	return s.handleEntity(part.Header, part, part.FileName(), contentType, params, email)
+}
+
+// handleEntity hands the body of a part, or of a single-part message, to the handler registered for its media type.
+// handled is false when there is none.
+func (s *parseState) handleEntity(header textproto.MIMEHeader, r io.Reader, filename string, contentType string, params map[string]string, email *Email) (handled bool, err error) {
+	handlers := s.handlers
+	if handlers == nil {
+		handlers = DefaultContentHandlers
+	}
+
+	handler := handlers.lookup(contentType)
+	if handler == nil {
+		return false, nil
+	}
+
+	body, err := s.decodeContent(r, header.Get("Content-Transfer-Encoding"))
+	if err != nil {
+		return true, err
+	}
+
+	return true, handler(Part{
+		Header:      header,
+		ContentType: contentType,
+		Params:      params,
+		FileName:    decodeMimeSentence(filename),
+		Body:        body,
+	}, email)
+}
+
+// entityFileName returns the filename of the Content-Disposition of an entity like multipart.Part.FileName
+func entityFileName(header textproto.MIMEHeader) string {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return ""
+	}
+
+	return filepath.Base(params["filename"])
+}
@@ -0,0 +1,185 @@
+package parsemail
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestContentHandlers(t *testing.T) {
+	var testData = map[int]struct {
+		mediaType        string
+		mailData         string
+		handlerErr       error
+		expectedErr      error
+		expectedHandled  []string
+		expectedBodies   []string
+		expectedTextBody string
+	}{
+		1: {
+			mediaType:        "application/json",
+			mailData:         jsonInMixedExample,
+			expectedHandled:  []string{"application/json"},
+			expectedBodies:   []string{`{"status": "ok"}`},
+			expectedTextBody: "See the status.",
+		},
+		2: {
+			// wildcards don't take the media types parsed by the package
+			mediaType:        "text/*",
+			mailData:         markdownInAlternativeExample,
+			expectedHandled:  []string{"text/markdown"},
+			expectedBodies:   []string{"# Hello"},
+			expectedTextBody: "Hello",
+		},
+		3: {
+			mediaType:        "text/markdown",
+			mailData:         markdownInAlternativeExample,
+			expectedHandled:  []string{"text/markdown"},
+			expectedBodies:   []string{"# Hello"},
+			expectedTextBody: "Hello",
+		},
+		4: {
+			mediaType:        "*/*",
+			mailData:         jsonInMixedExample,
+			expectedHandled:  []string{"application/json"},
+			expectedBodies:   []string{`{"status": "ok"}`},
+			expectedTextBody: "See the status.",
+		},
+		5: {
+			mediaType:   "application/json",
+			mailData:    jsonInMixedExample,
+			handlerErr:  errors.New("invalid status"),
+			expectedErr: errors.New("invalid status"),
+		},
+		6: {
+			// handlers registered for the media type itself take the parts parsed by the package
+			mediaType:        "text/plain",
+			mailData:         textPlainInMultipart,
+			expectedHandled:  []string{"text/plain"},
+			expectedBodies:   []string{"plain text part"},
+			expectedTextBody: "",
+		},
+		7: {
+			mediaType:        "application/json",
+			mailData:         jsonSinglePartExample,
+			expectedHandled:  []string{"application/json"},
+			expectedBodies:   []string{`{"status": "ok"}`},
+			expectedTextBody: "",
+		},
+	}
+
+	for index, td := range testData {
+		var handled, bodies []string
+		handlers := &ContentHandlers{}
+		handlers.Register(td.mediaType, func(part Part, email *Email) error {
+			b, err := ioutil.ReadAll(part.Body)
+			if err != nil {
+				return err
+			}
+
+			handled = append(handled, part.ContentType)
+			bodies = append(bodies, strings.TrimSuffix(string(b), "\n"))
+
+			return td.handlerErr
+		})
+
+		e, err := Parser{Handlers: handlers}.Parse(strings.NewReader(td.mailData))
+		if td.expectedErr != nil {
+			if err == nil || err.Error() != td.expectedErr.Error() {
+				t.Errorf("[Test Case %v] Wrong error. Expected: %v, Got: %v", index, td.expectedErr, err)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("[Test Case %v] Parse failed: %v", index, err)
+			continue
+		}
+
+		if !assertSliceEq(handled, td.expectedHandled) {
+			t.Errorf("[Test Case %v] Wrong handled parts. Expected: %s, Got: %s", index, td.expectedHandled, handled)
+		}
+
+		if !assertSliceEq(bodies, td.expectedBodies) {
+			t.Errorf("[Test Case %v] Wrong handled bodies. Expected: %s, Got: %s", index, td.expectedBodies, bodies)
+		}
+
+		if e.TextBody != td.expectedTextBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %s, Got: %s", index, td.expectedTextBody, e.TextBody)
+		}
+	}
+}
+
+func TestRegisterContentHandler(t *testing.T) {
+	if _, err := Parse(strings.NewReader(jsonInMixedExample)); err == nil {
+		t.Fatal("Expected the unknown media type to fail the parsing")
+	}
+
+	RegisterContentHandler("Application/JSON", func(part Part, email *Email) error {
+		email.Attachments = append(email.Attachments, Attachment{
+			Filename:    part.Params["name"],
+			ContentType: part.ContentType,
+			Data:        part.Body,
+		})
+
+		return nil
+	})
+	defer RegisterContentHandler("application/json", nil)
+
+	e, err := Parse(strings.NewReader(jsonInMixedExample))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(e.Attachments) != 1 || e.Attachments[0].Filename != "status.json" {
+		t.Fatalf("Wrong attachments. Expected: status.json, Got: %+v", e.Attachments)
+	}
+
+	data, err := ioutil.ReadAll(e.Attachments[0].Data)
+	if err != nil {
+		t.Fatalf("Reading the attachment failed: %v", err)
+	}
+
+	if string(data) != `{"status": "ok"}` {
+		t.Errorf("Wrong attachment data. Expected: %s, Got: %s", `{"status": "ok"}`, data)
+	}
+}
+
+var jsonInMixedExample = `From: John Doe <jdoe@machine.example>
+Subject: Status
+Content-Type: multipart/mixed; boundary=outer
+
+--outer
+Content-Type: text/plain; charset=UTF-8
+
+See the status.
+--outer
+Content-Type: application/json; name="status.json"
+Content-Transfer-Encoding: base64
+
+eyJzdGF0dXMiOiAib2sifQ==
+--outer--
+`
+
+var jsonSinglePartExample = `From: John Doe <jdoe@machine.example>
+Subject: Status
+Content-Type: application/json
+Content-Transfer-Encoding: base64
+
+eyJzdGF0dXMiOiAib2sifQ==
+`
+
+var markdownInAlternativeExample = `From: John Doe <jdoe@machine.example>
+Subject: Markdown
+Content-Type: multipart/alternative; boundary=alt
+
+--alt
+Content-Type: text/plain; charset=UTF-8
+
+Hello
+--alt
+Content-Type: text/markdown; charset=UTF-8
+
+# Hello
+--alt--
+`
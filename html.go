@@ -0,0 +1,237 @@
+package parsemail
+
+import (
+	"html"
+	"strings"
+)
+
+type htmlTokenType int
+
+const (
+	htmlTextToken htmlTokenType = iota
+	htmlStartTagToken
+	htmlEndTagToken
+	htmlSelfClosingTagToken
+	htmlCommentToken
+	htmlDoctypeToken
+)
+
+// htmlRawTextElements hold text up to their end tag, without any markup
+var htmlRawTextElements = map[string]bool{"script": true, "style": true, "textarea": true, "title": true, "xmp": true}
+
+// htmlAttribute with a lower cased name and an unescaped value
+type htmlAttribute struct {
+	name  string
+	value string
+}
+
+// htmlToken is a single piece of a HTML document. Raw holds the exact source of the token; name is the lower cased
+// tag name of tags.
+type htmlToken struct {
+	typ   htmlTokenType
+	name  string
+	attrs []htmlAttribute
+	raw   string
+}
+
+func (t htmlToken) attr(name string) (string, bool) {
+	for _, a := range t.attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+
+	return "", false
+}
+
+// text returns the unescaped contents of a text token
+func (t htmlToken) text() string {
+	return html.UnescapeString(t.raw)
+}
+
+// tokenizeHTML splits a HTML document into tokens. It is lenient in the way browsers are: anything that does not
+// look like markup is text, unterminated constructs run to the end of the document.
+func tokenizeHTML(s string) (tokens []htmlToken) {
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i == -1 {
+			tokens = append(tokens, htmlToken{typ: htmlTextToken, raw: s})
+			break
+		}
+
+		if i > 0 {
+			tokens = append(tokens, htmlToken{typ: htmlTextToken, raw: s[:i]})
+			s = s[i:]
+		}
+
+		var t htmlToken
+		var n int
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			n = strings.Index(s[4:], "-->")
+			if n == -1 {
+				n = len(s)
+			} else {
+				n += 4 + 3
+			}
+
+			t = htmlToken{typ: htmlCommentToken, raw: s[:n]}
+		case strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?"):
+			n = strings.IndexByte(s, '>')
+			if n == -1 {
+				n = len(s)
+			} else {
+				n++
+			}
+
+			t = htmlToken{typ: htmlDoctypeToken, raw: s[:n]}
+		case len(s) > 1 && (isASCIILetter(s[1]) || (s[1] == '/' && len(s) > 2 && isASCIILetter(s[2]))):
+			t, n = readHTMLTag(s)
+		default:
+			tokens = append(tokens, htmlToken{typ: htmlTextToken, raw: "<"})
+			s = s[1:]
+			continue
+		}
+
+		tokens = append(tokens, t)
+		s = s[n:]
+
+		if t.typ == htmlStartTagToken && htmlRawTextElements[t.name] {
+			end := indexFold(s, "</"+t.name)
+			if end == -1 {
+				end = len(s)
+			}
+
+			if end > 0 {
+				tokens = append(tokens, htmlToken{typ: htmlTextToken, raw: s[:end]})
+			}
+
+			s = s[end:]
+		}
+	}
+
+	return
+}
+
+// readHTMLTag reads a start or end tag at the beginning of s and returns it with its length
+func readHTMLTag(s string) (t htmlToken, n int) {
+	t.typ = htmlStartTagToken
+	i := 1
+	if s[i] == '/' {
+		t.typ = htmlEndTagToken
+		i++
+	}
+
+	start := i
+	for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' && s[i] != '/' {
+		i++
+	}
+
+	t.name = strings.ToLower(s[start:i])
+
+	for i < len(s) {
+		for i < len(s) && (isHTMLSpace(s[i]) || s[i] == '/') {
+			if s[i] == '/' && i+1 < len(s) && s[i+1] == '>' && t.typ == htmlStartTagToken {
+				t.typ = htmlSelfClosingTagToken
+			}
+			i++
+		}
+
+		if i >= len(s) {
+			break
+		}
+
+		if s[i] == '>' {
+			i++
+			break
+		}
+
+		start = i
+		for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' && s[i] != '=' && (s[i] != '/' || i == start) {
+			i++
+		}
+
+		a := htmlAttribute{name: strings.ToLower(s[start:i])}
+
+		for i < len(s) && isHTMLSpace(s[i]) {
+			i++
+		}
+
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isHTMLSpace(s[i]) {
+				i++
+			}
+
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				q := s[i]
+				i++
+				start = i
+				for i < len(s) && s[i] != q {
+					i++
+				}
+
+				a.value = html.UnescapeString(s[start:i])
+				if i < len(s) {
+					i++
+				}
+			} else {
+				start = i
+				for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+
+				a.value = html.UnescapeString(s[start:i])
+			}
+		}
+
+		if t.typ != htmlEndTagToken && a.name != "" {
+			t.attrs = append(t.attrs, a)
+		}
+	}
+
+	t.raw = s[:i]
+
+	return t, i
+}
+
+// renderHTMLTag serializes a start tag with its (possibly modified) attributes
+func renderHTMLTag(t htmlToken) string {
+	var b strings.Builder
+	b.WriteString("<")
+	b.WriteString(t.name)
+	for _, a := range t.attrs {
+		b.WriteString(" ")
+		b.WriteString(a.name)
+		b.WriteString(`="`)
+		b.WriteString(html.EscapeString(a.value))
+		b.WriteString(`"`)
+	}
+
+	if t.typ == htmlSelfClosingTagToken {
+		b.WriteString(" /")
+	}
+
+	b.WriteString(">")
+
+	return b.String()
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// indexFold is strings.Index ignoring ASCII case
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,305 @@
+package parsemail
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// htmlBlockElements start and end on their own line
+var htmlBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "center": true, "dd": true, "details": true, "dialog": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true, "footer": true,
+	"form": true, "header": true, "li": true, "main": true, "nav": true, "ol": true, "section": true,
+	"summary": true, "table": true, "tbody": true, "tfoot": true, "thead": true, "tr": true, "ul": true,
+}
+
+// htmlParagraphElements are separated from the surrounding text by an empty line
+var htmlParagraphElements = map[string]bool{
+	"blockquote": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "p": true, "pre": true,
+}
+
+// htmlSkippedElements are not rendered at all
+var htmlSkippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true, "template": true, "noscript": true,
+	"object": true, "applet": true, "iframe": true, "select": true, "textarea": true,
+}
+
+// PlainText returns the plain text body of the email, falling back to a conversion of the html body if the email
+// has no plain text body
+func (e Email) PlainText() string {
+	if strings.TrimSpace(e.TextBody) != "" {
+		return e.TextBody
+	}
+
+	return HTMLToText(e.HTMLBody)
+}
+
+// HTMLToText converts a HTML document to plain text. Block elements are put on their own lines, list items are
+// bulleted or numbered, table cells are separated by " | ", links are rendered as "text <url>", blockquotes are
+// quoted with "> " and scripts and styles are removed.
+func HTMLToText(html string) string {
+	w := &textWriter{}
+
+	var lists []int // -1 for unordered lists, the next item number for ordered lists
+	var links []string
+	skip := 0
+	pre := 0
+	cells := 0
+
+	for _, t := range tokenizeHTML(html) {
+		switch t.typ {
+		case htmlTextToken:
+			if skip > 0 {
+				continue
+			}
+
+			if pre > 0 {
+				w.writePre(t.text())
+			} else {
+				w.writeText(t.text())
+			}
+		case htmlStartTagToken, htmlSelfClosingTagToken:
+			if htmlSkippedElements[t.name] {
+				if t.typ == htmlStartTagToken {
+					skip++
+				}
+
+				continue
+			}
+
+			if skip > 0 {
+				continue
+			}
+
+			switch {
+			case t.name == "br":
+				w.forceBreak()
+			case t.name == "hr":
+				w.breakLine(1)
+				w.emit("----------")
+				w.breakLine(1)
+			case t.name == "img":
+				if alt, _ := t.attr("alt"); strings.TrimSpace(alt) != "" {
+					w.writeText(alt)
+				}
+			case t.name == "a":
+				href, _ := t.attr("href")
+				links = append(links, href)
+				w.mark = w.b.Len()
+			case t.name == "ol" || t.name == "ul":
+				w.breakLine(1)
+				n := -1
+				if t.name == "ol" {
+					n = 1
+					if start, err := strconv.Atoi(attrOrEmpty(t, "start")); err == nil {
+						n = start
+					}
+				}
+
+				lists = append(lists, n)
+			case t.name == "li":
+				w.breakLine(1)
+				prefix := "* "
+				if len(lists) > 0 && lists[len(lists)-1] > 0 {
+					prefix = strconv.Itoa(lists[len(lists)-1]) + ". "
+					lists[len(lists)-1]++
+				}
+
+				w.emit(strings.Repeat("  ", maxInt(len(lists)-1, 0)) + prefix)
+				w.space = false
+			case t.name == "tr":
+				w.breakLine(1)
+				cells = 0
+			case t.name == "td" || t.name == "th":
+				if cells > 0 {
+					w.emit(" | ")
+					w.space = false
+				}
+				cells++
+			case t.name == "blockquote":
+				w.breakLine(2)
+				w.quote++
+			case t.name == "pre":
+				w.breakLine(2)
+				pre++
+			case htmlParagraphElements[t.name]:
+				w.breakLine(2)
+			case htmlBlockElements[t.name]:
+				w.breakLine(1)
+			}
+		case htmlEndTagToken:
+			if htmlSkippedElements[t.name] {
+				if skip > 0 {
+					skip--
+				}
+
+				continue
+			}
+
+			if skip > 0 {
+				continue
+			}
+
+			switch {
+			case t.name == "a":
+				if len(links) == 0 {
+					continue
+				}
+
+				href := links[len(links)-1]
+				links = links[:len(links)-1]
+				w.writeLink(href)
+			case t.name == "ol" || t.name == "ul":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+
+				w.breakLine(1)
+			case t.name == "blockquote":
+				w.breakLine(2)
+				if w.quote > 0 {
+					w.quote--
+				}
+			case t.name == "pre":
+				if pre > 0 {
+					pre--
+				}
+
+				w.breakLine(2)
+			case htmlParagraphElements[t.name]:
+				w.breakLine(2)
+			case htmlBlockElements[t.name]:
+				w.breakLine(1)
+			}
+		}
+	}
+
+	return strings.TrimSpace(multipleBlankLinesRe.ReplaceAllString(w.b.String(), "\n\n"))
+}
+
+// textWriter collapses whitespace and line breaks of the rendered text
+type textWriter struct {
+	b        strings.Builder
+	newlines int
+	space    bool
+	quote    int
+	// mark is the position in the output where the current link text starts
+	mark int
+}
+
+func (w *textWriter) writeText(s string) {
+	if s == "" {
+		return
+	}
+
+	if r, _ := utf8.DecodeRuneInString(s); unicode.IsSpace(r) {
+		w.space = true
+	}
+
+	for i, word := range strings.Fields(s) {
+		if i > 0 {
+			w.space = true
+		}
+
+		w.emit(word)
+	}
+
+	if r, _ := utf8.DecodeLastRuneInString(s); unicode.IsSpace(r) {
+		w.space = true
+	}
+}
+
+func (w *textWriter) writePre(s string) {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			w.forceBreak()
+		}
+
+		if line != "" {
+			w.space = false
+			w.emit(line)
+		}
+	}
+}
+
+// writeLink appends the url to the link text written since the link started, unless it adds no information
+func (w *textWriter) writeLink(href string) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+
+	text := ""
+	if w.mark <= w.b.Len() {
+		text = strings.TrimSpace(w.b.String()[w.mark:])
+	}
+
+	target := strings.TrimPrefix(href, "mailto:")
+	if text == href || text == target {
+		return
+	}
+
+	if text == "" {
+		w.space = w.b.Len() > 0
+		w.emit(href)
+		return
+	}
+
+	w.space = true
+	w.emit("<" + href + ">")
+}
+
+// emit writes s preceded by the pending line breaks or space
+func (w *textWriter) emit(s string) {
+	if w.b.Len() > 0 {
+		if w.newlines > 0 {
+			w.b.WriteString(strings.Repeat("\n", w.newlines))
+		} else if w.space {
+			w.b.WriteString(" ")
+		}
+	}
+
+	if (w.newlines > 0 || w.b.Len() == 0) && w.quote > 0 {
+		w.b.WriteString(strings.Repeat("> ", w.quote))
+	}
+
+	w.b.WriteString(s)
+	w.newlines = 0
+	w.space = false
+}
+
+// breakLine makes sure the next text starts after at least n line breaks
+func (w *textWriter) breakLine(n int) {
+	if n > w.newlines {
+		w.newlines = n
+	}
+}
+
+// forceBreak adds a line break, even if one is already pending
+func (w *textWriter) forceBreak() {
+	if w.b.Len() == 0 {
+		return
+	}
+
+	w.newlines++
+}
+
+func attrOrEmpty(t htmlToken, name string) string {
+	v, _ := t.attr(name)
+
+	return v
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+var multipleBlankLinesRe = regexp.MustCompile(`\n{3,}`)
@@ -0,0 +1,52 @@
+package parsemail
+
+import (
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	var testData = map[int]struct {
+		html string
+		text string
+	}{
+		1: {
+			html: "<div dir=\"ltr\"><div>Time for the egg.</div><div><br></div><div><br><br></div></div>",
+			text: "Time for the egg.",
+		},
+		2: {
+			html: `<html><head><title>Newsletter</title><style>p { color: red; }</style></head>
+<body><h1>Hello&nbsp;World</h1><p>First   paragraph
+with <b>bold</b> text &amp; an <a href="https://example.com/">example link</a>.</p>
+<script>alert("<p>no</p>")</script><p>Mail <a href="mailto:jdoe@machine.example">jdoe@machine.example</a></p></body></html>`,
+			text: "Hello World\n\nFirst paragraph with bold text & an example link <https://example.com/>.\n\nMail jdoe@machine.example",
+		},
+		3: {
+			html: `<ul><li>one</li><li>two<ol><li>a</li><li>b</li></ol></li></ul><table><tr><th>Name</th><th>Value</th></tr><tr><td>x</td><td>1</td></tr></table>`,
+			text: "* one\n* two\n  1. a\n  2. b\nName | Value\nx | 1",
+		},
+		4: {
+			html: `<p>See below</p><blockquote><p>Quoted<br>text</p></blockquote><pre>  keep
+   spacing</pre><img src="cid:logo" alt="Logo">`,
+			text: "See below\n\n> Quoted\n> text\n\n  keep\n   spacing\n\nLogo",
+		},
+	}
+
+	for index, td := range testData {
+		text := HTMLToText(td.html)
+		if td.text != text {
+			t.Errorf("[Test Case %v] Wrong text. Expected: '%s', Got: '%s'", index, td.text, text)
+		}
+	}
+}
+
+func TestEmailPlainText(t *testing.T) {
+	e := Email{TextBody: "plain", HTMLBody: "<p>html</p>"}
+	if e.PlainText() != "plain" {
+		t.Errorf("Wrong plain text. Expected: 'plain', Got: '%s'", e.PlainText())
+	}
+
+	e.TextBody = ""
+	if e.PlainText() != "html" {
+		t.Errorf("Wrong plain text. Expected: 'html', Got: '%s'", e.PlainText())
+	}
+}
@@ -0,0 +1,260 @@
+package parsemail
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// InlineReport lists the references of the html body that could not be resolved and the embedded files that are
+// not referenced by it
+type InlineReport struct {
+	Missing      []string
+	Unreferenced []EmbeddedFile
+}
+
+// InlineHTML returns the html body with references to embedded files ("cid:" URLs and Content-Location URLs)
+// replaced by data: URIs. Relative references are resolved against the base of the html body, see RFC 2557. See
+// InlineHTMLFunc for using custom URLs.
+func (e Email) InlineHTML() (string, InlineReport, error) {
+	return e.InlineHTMLFunc(nil)
+}
+
+// InlineHTMLFunc returns the html body with references to embedded files replaced by the URLs returned by resolve.
+// If resolve is nil or returns "", the embedded file is inlined as a data: URI.
+func (e Email) InlineHTMLFunc(resolve func(EmbeddedFile) string) (string, InlineReport, error) {
+	var report InlineReport
+	var b strings.Builder
+	var err error
+
+	referenced := make([]bool, len(e.EmbeddedFiles))
+	urls := map[int]string{}
+	base, baseSet := e.HTMLBase, false
+
+	rewrite := func(ref string) (string, bool) {
+		i := e.findEmbeddedFile(ref, base)
+		if i == -1 {
+			if isCIDURL(ref) {
+				report.Missing = appendUnique(report.Missing, ref)
+			}
+
+			return ref, false
+		}
+
+		referenced[i] = true
+		if u, ok := urls[i]; ok {
+			return u, true
+		}
+
+		u := ""
+		if resolve != nil {
+			u = resolve(e.EmbeddedFiles[i])
+		}
+
+		if u == "" {
+			u, err = dataURI(e.EmbeddedFiles[i])
+		}
+
+		urls[i] = u
+
+		return u, true
+	}
+
+	for _, t := range tokenizeHTML(e.HTMLBody) {
+		if t.typ != htmlStartTagToken && t.typ != htmlSelfClosingTagToken {
+			b.WriteString(t.raw)
+			continue
+		}
+
+		// the first base element sets the base of the references of the html body
+		if t.name == "base" && !baseSet {
+			if href, ok := t.attr("href"); ok {
+				base, baseSet = resolveLocation(base, href), true
+			}
+		}
+
+		changed := false
+		for i, a := range t.attrs {
+			switch {
+			case htmlResourceAttributes[a.name] || (a.name == "href" && isCIDURL(a.value)):
+				if u, ok := rewrite(strings.TrimSpace(a.value)); ok {
+					t.attrs[i].value = u
+					changed = true
+				}
+			case a.name == "style" && cssURLRe.MatchString(a.value):
+				t.attrs[i].value = cssURLRe.ReplaceAllStringFunc(a.value, func(m string) string {
+					if u, ok := rewrite(strings.TrimSpace(cssURLRe.FindStringSubmatch(m)[1])); ok {
+						changed = true
+						return "url('" + u + "')"
+					}
+
+					return m
+				})
+			}
+		}
+
+		if err != nil {
+			return "", report, err
+		}
+
+		if changed {
+			b.WriteString(renderHTMLTag(t))
+		} else {
+			b.WriteString(t.raw)
+		}
+	}
+
+	for i, ef := range e.EmbeddedFiles {
+		if !referenced[i] {
+			report.Unreferenced = append(report.Unreferenced, ef)
+		}
+	}
+
+	return b.String(), report, nil
+}
+
+// findEmbeddedFile returns the index of the embedded file referenced by a cid: URL or by its Content-Location, with
+// relative references resolved against base
+func (e Email) findEmbeddedFile(ref, base string) int {
+	if isCIDURL(ref) {
+		cid := ref[len("cid:"):]
+		if unescaped, err := url.PathUnescape(cid); err == nil {
+			cid = unescaped
+		}
+
+		cid = strings.Trim(cid, "<>")
+		for i, ef := range e.EmbeddedFiles {
+			if strings.EqualFold(ef.CID, cid) {
+				return i
+			}
+		}
+
+		return -1
+	}
+
+	if ref == "" {
+		return -1
+	}
+
+	location := normalizeLocation(resolveLocation(base, ref))
+	for i, ef := range e.EmbeddedFiles {
+		if ef.Location != "" && normalizeLocation(ef.Location) == location {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// entityBase returns the base location of an entity, from its Content-Base and Content-Location resolved against
+// the base of the enclosing entity
+func entityBase(parent string, header textproto.MIMEHeader) string {
+	base := parent
+	if contentBase := header.Get("Content-Base"); contentBase != "" {
+		base = resolveLocation(base, contentBase)
+	}
+
+	if location := header.Get("Content-Location"); location != "" {
+		base = resolveLocation(base, location)
+	}
+
+	return base
+}
+
+// resolveLocation resolves a relative location against base. Folded header values are unfolded by removing the
+// whitespace, see RFC 2557 section 4.3.
+func resolveLocation(base, location string) string {
+	location = strings.Join(strings.Fields(location), "")
+	if base == "" {
+		return location
+	}
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return location
+	}
+
+	l, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+
+	return b.ResolveReference(l).String()
+}
+
+// normalizeLocation returns location with the scheme and the host in lower case and the percent-encoding
+// normalized, so that equivalent locations compare equal
+func normalizeLocation(location string) string {
+	if u, err := url.Parse(location); err == nil {
+		u.Host = strings.ToLower(u.Host)
+		location = u.String()
+	}
+
+	return normalizePercentEncoding(location)
+}
+
+// normalizePercentEncoding decodes the percent-encoded unreserved characters of s and upper cases the hex digits of
+// the other percent-encodings, see RFC 3986 section 6.2.2
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHexDigit(s[i+1]) || !isHexDigit(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := hexValue(s[i+1])<<4 | hexValue(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+
+		i += 2
+	}
+
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+
+	return c - '0'
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) != -1
+}
+
+func isCIDURL(ref string) bool {
+	return len(ref) > 4 && strings.EqualFold(ref[:4], "cid:")
+}
+
+func dataURI(ef EmbeddedFile) (string, error) {
+	data, err := readData(ef.Data)
+	if err != nil {
+		return "", err
+	}
+
+	contentType, _, err := mime.ParseMediaType(ef.ContentType)
+	if err != nil {
+		contentType = "application/octet-stream"
+	}
+
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
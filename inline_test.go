@@ -0,0 +1,155 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineHTML(t *testing.T) {
+	e, err := Parse(strings.NewReader(inlineExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.EmbeddedFiles) != 3 {
+		t.Fatalf("Incorrect number of embedded files! Expected: 3, Got: %v.", len(e.EmbeddedFiles))
+	}
+
+	html, report, err := e.InlineHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<html><body><img src="data:image/gif;base64,R0lGODlhAQE7" alt="logo"><img src="cid:missing@example.com">` +
+		`<div style="background: url(&#39;data:image/png;base64,iVBORw==&#39;)">text</div><img src="data:image/gif;base64,R0lGODlhAQE7"></body></html>`
+	if html != expected {
+		t.Errorf("Wrong html. Expected: '%s', Got: '%s'", expected, html)
+	}
+
+	if !assertSliceEq(report.Missing, []string{"cid:missing@example.com"}) {
+		t.Errorf("Wrong missing references. Got: %s", report.Missing)
+	}
+
+	if len(report.Unreferenced) != 1 || report.Unreferenced[0].CID != "unused@example.com" {
+		t.Errorf("Wrong unreferenced files. Got: %v", report.Unreferenced)
+	}
+
+	html, _, err = e.InlineHTMLFunc(func(ef EmbeddedFile) string {
+		if ef.CID != "" {
+			return "https://files.example.com/" + ef.CID
+		}
+
+		return ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `<html><body><img src="https://files.example.com/logo@example.com" alt="logo"><img src="cid:missing@example.com">` +
+		`<div style="background: url(&#39;data:image/png;base64,iVBORw==&#39;)">text</div><img src="https://files.example.com/logo@example.com"></body></html>`
+	if html != expected {
+		t.Errorf("Wrong html. Expected: '%s', Got: '%s'", expected, html)
+	}
+}
+
+func TestInlineHTMLRelativeLocations(t *testing.T) {
+	e, err := Parse(strings.NewReader(inlineRelativeExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.HTMLBase != "http://example.com/pages/index.html" {
+		t.Errorf("Wrong html base. Got: '%s'", e.HTMLBase)
+	}
+
+	expectedLocations := []string{"http://example.com/pages/images/a%7eb.png", "http://example.com/pages/bg.png"}
+	for i, ef := range e.EmbeddedFiles {
+		if i >= len(expectedLocations) || ef.Location != expectedLocations[i] {
+			t.Errorf("Wrong location of embedded file %v. Got: '%s'", i, ef.Location)
+		}
+	}
+
+	html, report, err := e.InlineHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<html><body><img src="data:image/gif;base64,R0lGODlhAQE7"><div style="background: url(&#39;data:image/png;base64,iVBORw==&#39;)">text</div>` +
+		`<img src="data:image/png;base64,iVBORw=="><img src="other.png"></body></html>`
+	if html != expected {
+		t.Errorf("Wrong html. Expected: '%s', Got: '%s'", expected, html)
+	}
+
+	if len(report.Unreferenced) != 0 {
+		t.Errorf("Wrong unreferenced files. Got: %v", report.Unreferenced)
+	}
+
+	e.HTMLBody = `<html><head><base href="http://EXAMPLE.com/pages/images/"></head><body><img src="a~b.png"><img src="bg.png"></body></html>`
+	html, _, err = e.InlineHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `<html><head><base href="http://EXAMPLE.com/pages/images/"></head><body><img src="data:image/gif;base64,R0lGODlhAQE7"><img src="bg.png"></body></html>`
+	if html != expected {
+		t.Errorf("Wrong html with base element. Expected: '%s', Got: '%s'", expected, html)
+	}
+}
+
+var inlineRelativeExample = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: Inline images
+Date: Fri, 21 Nov 1997 09:55:06 -0600
+Content-Location: http://example.com/pages/
+Content-Type: multipart/related; boundary="000000000000ab2e2205a26de587"
+
+--000000000000ab2e2205a26de587
+Content-Type: text/html; charset="UTF-8"
+Content-Location: index.html
+
+<html><body><img src="images/a~b.png"><div style="background: url(./bg.png)">text</div><img src="HTTP://Example.COM/pages/bg.png"><img src="other.png"></body></html>
+--000000000000ab2e2205a26de587
+Content-Type: image/gif
+Content-Transfer-Encoding: base64
+Content-Location: images/a%7eb.png
+
+R0lGODlhAQE7
+--000000000000ab2e2205a26de587
+Content-Type: image/png
+Content-Transfer-Encoding: base64
+Content-Location: bg.png
+
+iVBORw==
+--000000000000ab2e2205a26de587--
+`
+
+var inlineExample = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: Inline images
+Date: Fri, 21 Nov 1997 09:55:06 -0600
+Content-Type: multipart/related; boundary="000000000000ab2e2205a26de587"
+
+--000000000000ab2e2205a26de587
+Content-Type: text/html; charset="UTF-8"
+
+<html><body><img src="cid:logo@example.com" alt="logo"><img src="cid:missing@example.com"><div style="background: url(http://example.com/bg.png)">text</div><IMG SRC=cid:logo%40example.com></body></html>
+--000000000000ab2e2205a26de587
+Content-Type: image/gif; name="logo.gif"
+Content-Transfer-Encoding: base64
+Content-ID: <logo@example.com>
+
+R0lGODlhAQE7
+--000000000000ab2e2205a26de587
+Content-Type: image/png
+Content-Transfer-Encoding: base64
+Content-Location: http://example.com/bg.png
+
+iVBORw==
+--000000000000ab2e2205a26de587
+Content-Type: image/png
+Content-Transfer-Encoding: base64
+Content-ID: <unused@example.com>
+
+iVBORw==
+--000000000000ab2e2205a26de587--
+`
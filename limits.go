@@ -0,0 +1,267 @@
+package parsemail
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+)
+
+// readAhead is the data the readers of the message and of its multipart bodies may buffer ahead of the part being
+// parsed, within which the part size limit is enforced
+const readAhead = 2 * 4096
+
+// Limits bound the resources used to parse untrusted messages. Zero values are unlimited.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of multipart bodies, of the messages nested in reports and of security
+	// layers
+	MaxDepth int
+	// MaxParts is the maximum number of body parts
+	MaxParts int
+	// MaxHeaderBytes is the maximum size of the header of the message and of each body part
+	MaxHeaderBytes int
+	// MaxHeaderFields is the maximum number of header fields of the message and of each body part
+	MaxHeaderFields int
+	// MaxPartBytes is the maximum size of the body of the message and of each body part, and of the data decoded from a
+	// part, e.g. decompressed or decrypted. The raw bodies are read through buffers, so their limit is approximate: a
+	// body may exceed it by up to the size of the buffers, about 8 KiB, before the parsing fails
+	MaxPartBytes int64
+	// MaxTotalBytes is the maximum size of the message, including the data decoded from it
+	MaxTotalBytes int64
+}
+
+// LimitError is returned when a message exceeds one of the Limits of the Parser, as one of the Err*Limit values
+type LimitError struct {
+	limit string
+}
+
+func (e *LimitError) Error() string {
+	return "message exceeds the " + e.limit + " limit"
+}
+
+var (
+	ErrDepthLimit        = &LimitError{"nesting depth"}
+	ErrPartsLimit        = &LimitError{"number of parts"}
+	ErrHeaderSizeLimit   = &LimitError{"header size"}
+	ErrHeaderFieldsLimit = &LimitError{"number of header fields"}
+	ErrPartSizeLimit     = &LimitError{"part size"}
+	ErrTotalSizeLimit    = &LimitError{"message size"}
+)
+
+// Parser parses email messages like Parse, within the limits and with the content handlers
+type Parser struct {
+	Limits Limits
+	// Handlers process body parts by media type, DefaultContentHandlers when nil
+	Handlers *ContentHandlers
+}
+
+// Parse an email message read from io.Reader into parsemail.Email struct. Exceeding a limit fails the parsing with
+// a *LimitError.
+func (p Parser) Parse(r io.Reader) (email Email, err error) {
+	return p.ParseContext(context.Background(), r)
+}
+
+// parseState with the usage of the limits while parsing a message
+type parseState struct {
+	ctx      context.Context
+	limits   Limits
+	handlers *ContentHandlers
+	depth    int
+	parts    int
+	// read is the number of bytes read from the message and decoded from it, partStart the number when the current
+	// part started
+	read      int64
+	partStart int64
+	// entities of a message held in memory, see ParseBytes, with the message at index firstPart of the parts
+	entities  []indexedEntity
+	firstPart int
+	buf       []byte
+	// base is the base location of the current entity, bases the base locations of the enclosing multipart entities,
+	// see RFC 2557
+	base  string
+	bases []string
+}
+
+func (s *parseState) enterMultipart() error {
+	s.depth++
+	s.bases = append(s.bases, s.base)
+	if s.limits.MaxDepth > 0 && s.depth > s.limits.MaxDepth {
+		return ErrDepthLimit
+	}
+
+	return nil
+}
+
+func (s *parseState) leaveMultipart() {
+	s.depth--
+	if len(s.bases) > 0 {
+		s.base, s.bases = s.bases[len(s.bases)-1], s.bases[:len(s.bases)-1]
+	}
+}
+
+// startPart checks the limits of a new body part, whose header has already been read, and the cancellation of the
+// parsing
+func (s *parseState) startPart(part *multipart.Part) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	s.parts++
+	if s.limits.MaxParts > 0 && s.parts > s.limits.MaxParts {
+		return ErrPartsLimit
+	}
+
+	fields, size := 0, 0
+	for key, values := range part.Header {
+		for _, value := range values {
+			fields++
+			size += len(key) + len(value) + 4
+		}
+	}
+
+	if s.limits.MaxHeaderFields > 0 && fields > s.limits.MaxHeaderFields {
+		return ErrHeaderFieldsLimit
+	}
+
+	if s.limits.MaxHeaderBytes > 0 && size > s.limits.MaxHeaderBytes {
+		return ErrHeaderSizeLimit
+	}
+
+	s.partStart = s.read
+
+	if e, ok := s.indexedEntity(); ok {
+		referenceHeader(part.Header, e.header)
+	}
+
+	if len(s.bases) > 0 {
+		s.base = entityBase(s.bases[len(s.bases)-1], part.Header)
+	}
+
+	return nil
+}
+
+// expand counts data decoded from the message, e.g. decompressed or decrypted, against the size of the part it's
+// decoded from and of the message
+func (s *parseState) expand(n int) error {
+	if s.limits.MaxPartBytes > 0 && int64(n) > s.limits.MaxPartBytes {
+		return ErrPartSizeLimit
+	}
+
+	s.read += int64(n)
+	if s.limits.MaxTotalBytes > 0 && s.read > s.limits.MaxTotalBytes {
+		return ErrTotalSizeLimit
+	}
+
+	return nil
+}
+
+// readMessage reads a message whose security layers are unwrapped before it's parsed, within the size limit of the
+// message
+func (s *parseState) readMessage(r io.Reader) ([]byte, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.limits.MaxTotalBytes > 0 {
+		r = io.LimitReader(r, s.limits.MaxTotalBytes-s.read+1)
+	}
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.read += int64(len(raw))
+	if s.limits.MaxTotalBytes > 0 && s.read > s.limits.MaxTotalBytes {
+		return nil, ErrTotalSizeLimit
+	}
+
+	return raw, nil
+}
+
+// isLimitError reports whether the parsing failed because of a limit or the cancellation of the parsing, rather than
+// the content of the message
+func (s *parseState) isLimitError(err error) bool {
+	_, ok := err.(*LimitError)
+
+	return ok || s.ctx.Err() != nil
+}
+
+// limitedReader reads the message, enforcing the size limits and the limits of the message header as it's read, and
+// stops reading once the parsing is cancelled
+type limitedReader struct {
+	r io.Reader
+	s *parseState
+
+	headerDone   bool
+	headerBytes  int
+	headerFields int
+	lineLength   int
+}
+
+func (lr *limitedReader) Read(b []byte) (int, error) {
+	s := lr.s
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := lr.r.Read(b)
+	s.read += int64(n)
+
+	if s.limits.MaxTotalBytes > 0 && s.read > s.limits.MaxTotalBytes {
+		return n, ErrTotalSizeLimit
+	}
+
+	if !lr.headerDone {
+		if limitErr := lr.scanHeader(b[:n]); limitErr != nil {
+			return n, limitErr
+		}
+	}
+
+	if s.limits.MaxPartBytes > 0 && lr.headerDone && s.read-s.partStart > s.limits.MaxPartBytes+readAhead {
+		return n, ErrPartSizeLimit
+	}
+
+	return n, err
+}
+
+// scanHeader counts the bytes and the fields of the message header, up to the empty line ending it, in b, the data
+// just added to the read bytes
+func (lr *limitedReader) scanHeader(b []byte) error {
+	limits := lr.s.limits
+	for i, c := range b {
+		lr.headerBytes++
+
+		switch {
+		case c == '\n':
+			if lr.lineLength == 0 {
+				// the body of the message counts as a part until the first multipart body part starts
+				lr.headerDone = true
+				// the rest of b already is the body
+				lr.s.partStart = lr.s.read - int64(len(b)-i-1)
+
+				return nil
+			}
+
+			lr.lineLength = 0
+		case c == '\r':
+		default:
+			// continuation lines start with whitespace
+			if lr.lineLength == 0 && c != ' ' && c != '\t' {
+				lr.headerFields++
+			}
+
+			lr.lineLength++
+		}
+
+		if limits.MaxHeaderBytes > 0 && lr.headerBytes > limits.MaxHeaderBytes {
+			return ErrHeaderSizeLimit
+		}
+
+		if limits.MaxHeaderFields > 0 && lr.headerFields > limits.MaxHeaderFields {
+			return ErrHeaderFieldsLimit
+		}
+	}
+
+	return nil
+}
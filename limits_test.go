@@ -0,0 +1,92 @@
+package parsemail
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParserLimits(t *testing.T) {
+	nested := "From: alice@example.com\nContent-Type: multipart/mixed; boundary=\"b0\"\n\n"
+	for i := 0; i < 4; i++ {
+		nested += fmt.Sprintf("--b%d\nContent-Type: multipart/alternative; boundary=\"b%d\"\n\n", i, i+1)
+		if i%2 == 0 {
+			nested = strings.Replace(nested, fmt.Sprintf("multipart/alternative; boundary=\"b%d\"", i+1), fmt.Sprintf("multipart/related; boundary=\"b%d\"", i+1), 1)
+		}
+	}
+
+	nested += "--b4\nContent-Type: text/plain\n\nDeep\n--b4--\n--b3--\n--b2--\n--b1--\n--b0--\n"
+
+	parts := "From: alice@example.com\nContent-Type: multipart/mixed; boundary=\"b\"\n\n" +
+		strings.Repeat("--b\nContent-Type: text/plain\n\nPart\n", 10) + "--b--\n"
+
+	fields := "From: alice@example.com\n" + strings.Repeat("X-Field: value\n", 100) + "\nBody"
+
+	partFields := "From: alice@example.com\nContent-Type: multipart/mixed; boundary=\"b\"\n\n--b\nContent-Type: text/plain\n" +
+		strings.Repeat("X-Field: value\n", 100) + "\nPart\n--b--\n"
+
+	large := "From: alice@example.com\nContent-Type: multipart/mixed; boundary=\"b\"\n\n--b\nContent-Type: text/plain\n\n" +
+		strings.Repeat("0123456789abcdef\n", 4096) + "--b--\n"
+
+	// feedback reports whose reported message is a feedback report, 50 levels deep
+	reports := "From: alice@example.com\n\nReported"
+	for i := 0; i < 50; i++ {
+		reports = fmt.Sprintf("From: abuse@example.com\nContent-Type: multipart/report; report-type=feedback-report; boundary=\"r%d\"\n\n"+
+			"--r%d\nContent-Type: message/feedback-report\n\nFeedback-Type: abuse\n\n"+
+			"--r%d\nContent-Type: message/rfc822\n\n%s\n--r%d--\n", i, i, i, reports, i)
+	}
+
+	// runs of 20 bytes expand about 5 times
+	binHex := "From: alice@example.com\n\n(This file must be converted with BinHex 4.0)\n:" +
+		encodeBinHex("runs.bin", []byte(strings.Repeat(strings.Repeat("a", 20)+strings.Repeat("b", 20), 4000))) + ":\n"
+
+	var testData = map[int]struct {
+		message string
+		limits  Limits
+		err     error
+	}{
+		1:  {message: nested, limits: Limits{MaxDepth: 5}},
+		2:  {message: nested, limits: Limits{MaxDepth: 4}, err: ErrDepthLimit},
+		3:  {message: parts, limits: Limits{MaxParts: 10}},
+		4:  {message: parts, limits: Limits{MaxParts: 9}, err: ErrPartsLimit},
+		5:  {message: fields, limits: Limits{MaxHeaderFields: 101}},
+		6:  {message: fields, limits: Limits{MaxHeaderFields: 100}, err: ErrHeaderFieldsLimit},
+		7:  {message: fields, limits: Limits{MaxHeaderBytes: 1000}, err: ErrHeaderSizeLimit},
+		8:  {message: partFields, limits: Limits{MaxHeaderFields: 50}, err: ErrHeaderFieldsLimit},
+		9:  {message: partFields, limits: Limits{MaxHeaderBytes: 1000}, err: ErrHeaderSizeLimit},
+		10: {message: large, limits: Limits{MaxPartBytes: 100000}},
+		11: {message: large, limits: Limits{MaxPartBytes: 50000}, err: ErrPartSizeLimit},
+		12: {message: large, limits: Limits{MaxTotalBytes: 50000}, err: ErrTotalSizeLimit},
+		13: {message: "From: alice@example.com\n\n" + strings.Repeat("body\n", 20000), limits: Limits{MaxPartBytes: 50000}, err: ErrPartSizeLimit},
+		14: {message: reports, limits: Limits{MaxDepth: 100}},
+		15: {message: reports, limits: Limits{MaxDepth: 3}, err: ErrDepthLimit},
+		16: {message: reports, limits: Limits{MaxParts: 99}, err: ErrPartsLimit},
+		17: {message: binHex, limits: Limits{MaxTotalBytes: 200000}},
+		18: {message: binHex, limits: Limits{MaxTotalBytes: 150000}, err: ErrTotalSizeLimit},
+		// the header and the start of the body are read at once
+		19: {message: "From: alice@example.com\n\n" + strings.Repeat("body\n", 1900), limits: Limits{MaxPartBytes: 1000}, err: ErrPartSizeLimit},
+	}
+
+	for index, td := range testData {
+		_, err := Parser{Limits: td.limits}.Parse(strings.NewReader(td.message))
+		if err != td.err {
+			t.Errorf("[Test Case %v] Wrong error. Expected: %v, Got: %v", index, td.err, err)
+		}
+	}
+}
+
+func TestParserWithoutLimits(t *testing.T) {
+	expected, err := Parse(strings.NewReader(multipartRelatedExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Parser{}.Parse(strings.NewReader(multipartRelatedExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.HTMLBody != expected.HTMLBody || len(e.EmbeddedFiles) != len(expected.EmbeddedFiles) {
+		t.Errorf("Wrong email. Expected: %+v, Got: %+v", expected, e)
+	}
+}
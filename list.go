@@ -0,0 +1,137 @@
+package parsemail
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ListInfo with the mailing list headers defined in RFC2369 and RFC2919
+type ListInfo struct {
+	// ID is the list identifier of the List-Id header, e.g. "list.example.com", and Name its description
+	ID   string
+	Name string
+
+	Help        []*url.URL
+	Subscribe   []*url.URL
+	Unsubscribe []*url.URL
+	Post        []*url.URL
+	Owner       []*url.URL
+	Archive     []*url.URL
+
+	// NoPosting is set if posting to the list is not allowed ("List-Post: NO")
+	NoPosting bool
+	// OneClickUnsubscribe is set if the list supports RFC8058 one-click unsubscription, by sending a POST request
+	// with the body "List-Unsubscribe=One-Click" to the https unsubscribe URL. RFC8058 requires a valid DKIM signature
+	// covering both headers, which is not verified.
+	OneClickUnsubscribe bool
+}
+
+var listURIRe = regexp.MustCompile(`<([^>]*)>`)
+var listIDRe = regexp.MustCompile(`^(.*?)<([^>]*)>`)
+
+// UnsubscribeMailto returns the first mailto: unsubscribe URL, or nil if there is none
+func (l ListInfo) UnsubscribeMailto() *url.URL {
+	return firstURLWithScheme(l.Unsubscribe, "mailto")
+}
+
+// UnsubscribeHTTPS returns the first https unsubscribe URL, or nil if there is none
+func (l ListInfo) UnsubscribeHTTPS() *url.URL {
+	return firstURLWithScheme(l.Unsubscribe, "https")
+}
+
+// parseListInfo returns nil if the header has no list headers
+func parseListInfo(header mail.Header) *ListInfo {
+	l := ListInfo{
+		Help:        parseListURIs(header.Get("List-Help")),
+		Subscribe:   parseListURIs(header.Get("List-Subscribe")),
+		Unsubscribe: parseListURIs(header.Get("List-Unsubscribe")),
+		Post:        parseListURIs(header.Get("List-Post")),
+		Owner:       parseListURIs(header.Get("List-Owner")),
+		Archive:     parseListURIs(header.Get("List-Archive")),
+	}
+
+	if m := listIDRe.FindStringSubmatch(header.Get("List-Id")); m != nil {
+		l.ID = strings.TrimSpace(m[2])
+		l.Name = strings.Trim(strings.TrimSpace(decodeMimeSentence(m[1])), `"`)
+	} else {
+		l.ID = strings.TrimSpace(header.Get("List-Id"))
+	}
+
+	post := strings.TrimSpace(header.Get("List-Post"))
+	l.NoPosting = len(post) >= 2 && strings.EqualFold(post[:2], "no") && (len(post) == 2 || !isASCIILetter(post[2]))
+
+	l.OneClickUnsubscribe = strings.EqualFold(strings.TrimSpace(header.Get("List-Unsubscribe-Post")), "List-Unsubscribe=One-Click") &&
+		l.UnsubscribeHTTPS() != nil
+
+	if l.ID == "" && l.Help == nil && l.Subscribe == nil && l.Unsubscribe == nil && l.Post == nil && l.Owner == nil &&
+		l.Archive == nil && !l.NoPosting {
+		return nil
+	}
+
+	return &l
+}
+
+// parseListURIs parses the angle bracketed URIs of a list header, ignoring comments and invalid URIs
+func parseListURIs(value string) (uris []*url.URL) {
+	for _, m := range listURIRe.FindAllStringSubmatch(removeComments(value), -1) {
+		u, err := url.Parse(strings.Join(strings.Fields(m[1]), ""))
+		if err != nil || u.Scheme == "" {
+			continue
+		}
+
+		uris = append(uris, u)
+	}
+
+	return
+}
+
+// removeComments removes the parenthesized comments of a header value, outside of quotes and angle brackets
+func removeComments(value string) string {
+	var b strings.Builder
+
+	depth := 0
+	quoted := false
+	angle := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case angle:
+			angle = c != '>'
+		case c == '<' && depth == 0 && !quoted:
+			angle = true
+		case c == '\\' && i+1 < len(value) && (quoted || depth > 0):
+			if depth == 0 {
+				b.WriteString(value[i : i+2])
+			}
+
+			i++
+			continue
+		case c == '"' && depth == 0:
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth++
+			continue
+		case c == ')' && !quoted && depth > 0:
+			depth--
+			continue
+		}
+
+		if depth == 0 {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func firstURLWithScheme(uris []*url.URL, scheme string) *url.URL {
+	for _, u := range uris {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return u
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package parsemail
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseListInfo(t *testing.T) {
+	var testData = map[int]struct {
+		mailData            string
+		id                  string
+		name                string
+		unsubscribe         []string
+		post                []string
+		archive             []string
+		noPosting           bool
+		oneClickUnsubscribe bool
+		noList              bool
+	}{
+		1: {
+			mailData:            listExample,
+			id:                  "golang-nuts.googlegroups.com",
+			name:                "Go Nuts",
+			unsubscribe:         []string{"mailto:golang-nuts+unsubscribe@googlegroups.com", "https://groups.google.com/unsubscribe/golang-nuts"},
+			post:                []string{"mailto:golang-nuts@googlegroups.com"},
+			archive:             []string{"https://groups.google.com/group/golang-nuts"},
+			oneClickUnsubscribe: true,
+		},
+		2: {
+			mailData: `From: news@example.com
+List-Id: <announce.example.com>
+List-Post: NO (posting not allowed on this list)
+List-Unsubscribe: (Use this command to get off the list)
+     <mailto:list-manager@example.com?body=unsubscribe%20announce>
+List-Unsubscribe-Post: List-Unsubscribe=One-Click
+Content-Type: text/plain
+
+Announcement`,
+			id:          "announce.example.com",
+			unsubscribe: []string{"mailto:list-manager@example.com?body=unsubscribe%20announce"},
+			noPosting:   true,
+		},
+		3: {
+			mailData: `From: someone@example.com
+List-Archive: <http://www.example.com/archive/(2019)/
+	list/>
+Content-Type: text/plain
+
+Text`,
+			archive: []string{"http://www.example.com/archive/(2019)/list/"},
+		},
+		4: {
+			mailData: `From: someone@example.com
+Content-Type: text/plain
+
+Text`,
+			noList: true,
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if td.noList {
+			if e.List != nil {
+				t.Errorf("[Test Case %v] Expected no list info, Got: %+v", index, e.List)
+			}
+
+			continue
+		}
+
+		if e.List == nil {
+			t.Errorf("[Test Case %v] Missing list info", index)
+			continue
+		}
+
+		if e.List.ID != td.id {
+			t.Errorf("[Test Case %v] Wrong list id. Expected: %s, Got: %s", index, td.id, e.List.ID)
+		}
+
+		if e.List.Name != td.name {
+			t.Errorf("[Test Case %v] Wrong list name. Expected: %s, Got: %s", index, td.name, e.List.Name)
+		}
+
+		for name, uris := range map[string][2][]string{
+			"unsubscribe": {td.unsubscribe, urlStrings(e.List.Unsubscribe)},
+			"post":        {td.post, urlStrings(e.List.Post)},
+			"archive":     {td.archive, urlStrings(e.List.Archive)},
+		} {
+			if strings.Join(uris[0], " ") != strings.Join(uris[1], " ") {
+				t.Errorf("[Test Case %v] Wrong %s URLs. Expected: %v, Got: %v", index, name, uris[0], uris[1])
+			}
+		}
+
+		if e.List.NoPosting != td.noPosting {
+			t.Errorf("[Test Case %v] Wrong no posting. Expected: %v, Got: %v", index, td.noPosting, e.List.NoPosting)
+		}
+
+		if e.List.OneClickUnsubscribe != td.oneClickUnsubscribe {
+			t.Errorf("[Test Case %v] Wrong one-click unsubscribe. Expected: %v, Got: %v", index, td.oneClickUnsubscribe, e.List.OneClickUnsubscribe)
+		}
+	}
+}
+
+func TestListInfoUnsubscribe(t *testing.T) {
+	e, err := Parse(strings.NewReader(listExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u := e.List.UnsubscribeMailto(); u == nil || u.Opaque != "golang-nuts+unsubscribe@googlegroups.com" {
+		t.Errorf("Wrong mailto unsubscribe URL: %v", u)
+	}
+
+	if u := e.List.UnsubscribeHTTPS(); u == nil || u.Host != "groups.google.com" {
+		t.Errorf("Wrong https unsubscribe URL: %v", u)
+	}
+}
+
+func urlStrings(uris []*url.URL) (s []string) {
+	for _, u := range uris {
+		s = append(s, u.String())
+	}
+
+	return
+}
+
+var listExample = `From: Gopher <gopher@example.com>
+To: golang-nuts@googlegroups.com
+Subject: [go-nuts] Generics
+List-Id: "Go Nuts" <golang-nuts.googlegroups.com>
+List-Post: <mailto:golang-nuts@googlegroups.com>
+List-Help: <https://support.google.com/a/example.com/bin/topic.py?topic=25838>,
+	<mailto:golang-nuts+help@googlegroups.com>
+List-Archive: <https://groups.google.com/group/golang-nuts>
+List-Unsubscribe: <mailto:golang-nuts+unsubscribe@googlegroups.com>,
+	<https://groups.google.com/unsubscribe/golang-nuts>
+List-Unsubscribe-Post: List-Unsubscribe=One-Click
+Content-Type: text/plain
+
+When?`
@@ -0,0 +1,300 @@
+package parsemail
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// MAPIProperty of a TNEF or Outlook message. Values are int64, bool, float64, string, []byte, time.Time or
+// []interface{} for multi-valued properties.
+type MAPIProperty struct {
+	ID   uint16
+	Type uint16
+	// GUID of the property set and Name or LID (numeric id) of named properties (ID >= 0x8000)
+	GUID  [16]byte
+	Name  string
+	LID   uint32
+	Value interface{}
+}
+
+const (
+	mapiTypeUnspecified = 0x0000
+	mapiTypeNull        = 0x0001
+	mapiTypeShort       = 0x0002
+	mapiTypeLong        = 0x0003
+	mapiTypeFloat       = 0x0004
+	mapiTypeDouble      = 0x0005
+	mapiTypeCurrency    = 0x0006
+	mapiTypeAppTime     = 0x0007
+	mapiTypeError       = 0x000A
+	mapiTypeBoolean     = 0x000B
+	mapiTypeObject      = 0x000D
+	mapiTypeInt64       = 0x0014
+	mapiTypeString8     = 0x001E
+	mapiTypeUnicode     = 0x001F
+	mapiTypeSysTime     = 0x0040
+	mapiTypeCLSID       = 0x0048
+	mapiTypeBinary      = 0x0102
+	mapiMultiValued     = 0x1000
+)
+
+const (
+	mapiSubject               = 0x0037
+	mapiClientSubmitTime      = 0x0039
+	mapiSentRepresentingName  = 0x0042
+	mapiSentRepresentingEmail = 0x0065
+	mapiTransportHeaders      = 0x007D
+	mapiRecipientType         = 0x0C15
+	mapiSenderName            = 0x0C1A
+	mapiSenderEmailAddress    = 0x0C1F
+	mapiMessageDeliveryTime   = 0x0E06
+	mapiBody                  = 0x1000
+	mapiRTFCompressed         = 0x1009
+	mapiBodyHTML              = 0x1013
+	mapiInternetMessageID     = 0x1035
+	mapiInReplyTo             = 0x1042
+	mapiDisplayName           = 0x3001
+	mapiEmailAddress          = 0x3003
+	mapiAttachDataBinary      = 0x3701
+	mapiAttachFilename        = 0x3704
+	mapiAttachLongFilename    = 0x3707
+	mapiAttachMimeTag         = 0x370E
+	mapiAttachContentID       = 0x3712
+	mapiAttachContentLocation = 0x3713
+	mapiSMTPAddress           = 0x39FE
+	mapiSenderSMTPAddress     = 0x5D01
+)
+
+var errInvalidMAPIProperties = errors.New("invalid MAPI properties")
+
+// leReader reads little endian values, remembering the first error
+type leReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *leReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || n > len(r.b)-r.off {
+		r.err = errInvalidMAPIProperties
+		return nil
+	}
+
+	b := r.b[r.off : r.off+n]
+	r.off += n
+
+	return b
+}
+
+func (r *leReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+
+	return 0
+}
+
+func (r *leReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+
+	return 0
+}
+
+func (r *leReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+
+	return 0
+}
+
+// pad skips the padding of a value of n bytes to a multiple of 4 bytes
+func (r *leReader) pad(n int) {
+	if n%4 != 0 {
+		r.next(4 - n%4)
+	}
+}
+
+// parseMAPIProperties parses a list of MAPI properties as encoded in TNEF attributes
+func parseMAPIProperties(b []byte) ([]MAPIProperty, error) {
+	r := &leReader{b: b}
+
+	var props []MAPIProperty
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		p := MAPIProperty{Type: r.uint16(), ID: r.uint16()}
+		if p.ID >= 0x8000 {
+			copy(p.GUID[:], r.next(16))
+			switch r.uint32() {
+			case 0:
+				p.LID = r.uint32()
+			case 1:
+				n := int(r.uint32())
+				p.Name = strings.TrimRight(decodeUTF16(r.next(n)), "\x00")
+				r.pad(n)
+			default:
+				return props, errInvalidMAPIProperties
+			}
+		}
+
+		if p.Type&mapiMultiValued != 0 {
+			var values []interface{}
+			n := r.uint32()
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				values = append(values, r.mapiValue(p.Type&^mapiMultiValued))
+			}
+
+			p.Value = values
+		} else {
+			if isVariableLengthMAPIType(p.Type) {
+				// the number of values, always 1
+				r.uint32()
+			}
+
+			p.Value = r.mapiValue(p.Type)
+		}
+
+		if r.err == nil {
+			props = append(props, p)
+		}
+	}
+
+	return props, r.err
+}
+
+func (r *leReader) mapiValue(typ uint16) interface{} {
+	switch typ {
+	case mapiTypeShort:
+		v := int64(int16(r.uint16()))
+		r.next(2)
+		return v
+	case mapiTypeLong, mapiTypeError:
+		return int64(int32(r.uint32()))
+	case mapiTypeBoolean:
+		v := r.uint16() != 0
+		r.next(2)
+		return v
+	case mapiTypeFloat:
+		return float64(math.Float32frombits(r.uint32()))
+	case mapiTypeDouble, mapiTypeAppTime:
+		return math.Float64frombits(r.uint64())
+	case mapiTypeCurrency, mapiTypeInt64:
+		return int64(r.uint64())
+	case mapiTypeSysTime:
+		return filetimeToTime(r.uint64())
+	case mapiTypeCLSID:
+		return append([]byte(nil), r.next(16)...)
+	case mapiTypeString8, mapiTypeUnicode, mapiTypeBinary, mapiTypeObject:
+		n := int(r.uint32())
+		data := r.next(n)
+		r.pad(n)
+		return decodeMAPIValue(typ, data)
+	case mapiTypeUnspecified, mapiTypeNull:
+		r.next(4)
+		return nil
+	}
+
+	r.err = errInvalidMAPIProperties
+
+	return nil
+}
+
+func isVariableLengthMAPIType(typ uint16) bool {
+	return typ == mapiTypeString8 || typ == mapiTypeUnicode || typ == mapiTypeBinary || typ == mapiTypeObject
+}
+
+// decodeMAPIValue decodes the data of a variable length value or of a fixed length value of 8 bytes
+func decodeMAPIValue(typ uint16, data []byte) interface{} {
+	switch typ {
+	case mapiTypeString8:
+		return strings.TrimRight(string(data), "\x00")
+	case mapiTypeUnicode:
+		return strings.TrimRight(decodeUTF16(data), "\x00")
+	case mapiTypeBinary, mapiTypeObject, mapiTypeCLSID:
+		return append([]byte(nil), data...)
+	}
+
+	if len(data) < 8 {
+		return nil
+	}
+
+	switch typ {
+	case mapiTypeShort:
+		return int64(int16(binary.LittleEndian.Uint16(data)))
+	case mapiTypeLong, mapiTypeError:
+		return int64(int32(binary.LittleEndian.Uint32(data)))
+	case mapiTypeBoolean:
+		return binary.LittleEndian.Uint16(data) != 0
+	case mapiTypeFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+	case mapiTypeDouble, mapiTypeAppTime:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data))
+	case mapiTypeCurrency, mapiTypeInt64:
+		return int64(binary.LittleEndian.Uint64(data))
+	case mapiTypeSysTime:
+		return filetimeToTime(binary.LittleEndian.Uint64(data))
+	}
+
+	return nil
+}
+
+// findMAPIProperty returns the value of the property with the id, or nil
+func findMAPIProperty(props []MAPIProperty, id uint16) interface{} {
+	for _, p := range props {
+		if p.ID == id {
+			return p.Value
+		}
+	}
+
+	return nil
+}
+
+// mapiString returns string and binary values as strings
+func mapiString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return strings.TrimRight(string(v), "\x00")
+	}
+
+	return ""
+}
+
+func mapiBytes(v interface{}) []byte {
+	b, _ := v.([]byte)
+
+	return b
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+
+	return string(utf16.Decode(u))
+}
+
+// filetimeToTime converts the number of 100ns intervals since 1601 to a time
+func filetimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+
+	const epochDifference = 116444736000000000 // 100ns intervals between 1601 and 1970
+
+	t := int64(ft) - epochDifference
+
+	return time.Unix(t/10000000, t%10000000*100).UTC()
+}
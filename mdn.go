@@ -0,0 +1,139 @@
+package parsemail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const reportTypeDispositionNotification = "disposition-notification"
+
+// DispositionNotification with the fields of a RFC8098 message disposition notification (read receipt) and the
+// headers of the original message (if returned)
+type DispositionNotification struct {
+	ReportingUA       string
+	MDNGateway        string
+	OriginalRecipient string
+	FinalRecipient    string
+	OriginalMessageID string
+
+	// Disposition is the raw field, e.g. "manual-action/MDN-sent-manually; displayed"
+	Disposition string
+	// DispositionType is the disposition without the action and sending modes, e.g. "displayed" or "deleted"
+	DispositionType string
+
+	OriginalHeader mail.Header
+}
+
+func parseDispositionNotification(reports []reportPart) (dn *DispositionNotification) {
+	for _, r := range reports {
+		switch r.contentType {
+		case "message/disposition-notification", "message/global-disposition-notification":
+			groups := readFieldGroups(r.data)
+			if len(groups) == 0 || groups[0] == nil {
+				continue
+			}
+
+			g := groups[0]
+			hp := headerParser{}
+			dn = &DispositionNotification{
+				ReportingUA:       g.Get("Reporting-UA"),
+				MDNGateway:        stripFieldType(g.Get("MDN-Gateway")),
+				OriginalRecipient: stripFieldType(g.Get("Original-Recipient")),
+				FinalRecipient:    stripFieldType(g.Get("Final-Recipient")),
+				OriginalMessageID: hp.parseMessageId(g.Get("Original-Message-ID")),
+				Disposition:       g.Get("Disposition"),
+				DispositionType:   dispositionType(g.Get("Disposition")),
+			}
+		}
+	}
+
+	if dn == nil {
+		return
+	}
+
+	dn.OriginalHeader = parseReturnedHeader(reports)
+
+	return
+}
+
+// dispositionType strips the disposition mode and modifiers from a Disposition field
+func dispositionType(s string) string {
+	s = stripFieldType(s)
+	if i := strings.Index(s, "/"); i != -1 {
+		s = s[:i]
+	}
+
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// NewDispositionNotification creates a RFC8098 message disposition notification for the email, sent from the given
+// address to the addresses in its Disposition-Notification-To header. The disposition is the full field value, e.g.
+// "manual-action/MDN-sent-manually; displayed".
+func NewDispositionNotification(email Email, from *mail.Address, disposition string) ([]byte, error) {
+	if len(email.DispositionNotificationTo) == 0 {
+		return nil, fmt.Errorf("email has no Disposition-Notification-To header")
+	}
+
+	if from == nil {
+		return nil, fmt.Errorf("missing sender of the disposition notification")
+	}
+
+	var to []string
+	for _, a := range email.DispositionNotificationTo {
+		to = append(to, a.String())
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(text, "The message sent on %s to %s with subject \"%s\" has been %s.\r\n",
+		email.Date.Format(time.RFC1123Z), from.Address, email.Subject, dispositionType(disposition))
+
+	report, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"message/disposition-notification"}})
+	if err != nil {
+		return nil, err
+	}
+
+	if or := email.Header.Get("Original-Recipient"); or != "" {
+		fmt.Fprintf(report, "Original-Recipient: %s\r\n", or)
+	}
+
+	fmt.Fprintf(report, "Final-Recipient: rfc822; %s\r\n", from.Address)
+	if email.MessageID != "" {
+		fmt.Fprintf(report, "Original-Message-ID: <%s>\r\n", email.MessageID)
+	}
+
+	fmt.Fprintf(report, "Disposition: %s\r\n", disposition)
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Read: "+email.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if email.MessageID != "" {
+		fmt.Fprintf(&msg, "In-Reply-To: <%s>\r\n", email.MessageID)
+		fmt.Fprintf(&msg, "References: <%s>\r\n", email.MessageID)
+	}
+
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/report; report-type=%s; boundary=\"%s\"\r\n", reportTypeDispositionNotification, mw.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package parsemail
+
+import (
+	"bytes"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDispositionNotification(t *testing.T) {
+	e, err := Parse(strings.NewReader(mdnExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dn := e.DispositionNotification
+	if dn == nil {
+		t.Fatal("Missing disposition notification")
+	}
+
+	expected := DispositionNotification{
+		ReportingUA:       "mua.example.net; Example Mail 1.0",
+		OriginalRecipient: "mary@example.net",
+		FinalRecipient:    "mary@example.net",
+		OriginalMessageID: "1234@local.machine.example",
+		Disposition:       "manual-action/MDN-sent-manually; displayed",
+		DispositionType:   "displayed",
+	}
+
+	dn.OriginalHeader = nil
+	if !reflect.DeepEqual(*dn, expected) {
+		t.Errorf("Wrong disposition notification. Expected: %+v, Got: %+v", expected, *dn)
+	}
+
+	if e.TextBody != "The message was displayed." {
+		t.Errorf("Wrong text body. Got: '%s'", e.TextBody)
+	}
+}
+
+func TestNewDispositionNotification(t *testing.T) {
+	original, err := Parse(strings.NewReader(mdnRequestExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := dereferenceAddressList(original.DispositionNotificationTo)
+	if !assertAddressListEq([]mail.Address{{Name: "John Doe", Address: "jdoe@machine.example"}}, d) {
+		t.Errorf("Wrong disposition notification to. Got: %s", d)
+	}
+
+	if _, err := NewDispositionNotification(original, nil, "manual-action/MDN-sent-manually; displayed"); err == nil {
+		t.Error("Expected error for missing sender")
+	}
+
+	from := &mail.Address{Name: "Mary Smith", Address: "mary@example.net"}
+	b, err := NewDispositionNotification(original, from, "manual-action/MDN-sent-manually; displayed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mdn, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mdn.Subject != "Read: Saying Hello" {
+		t.Errorf("Wrong subject. Got: %s", mdn.Subject)
+	}
+
+	if !assertSliceEq(mdn.InReplyTo, []string{"1234@local.machine.example"}) {
+		t.Errorf("Wrong in reply to. Got: %s", mdn.InReplyTo)
+	}
+
+	if mdn.DispositionNotification == nil {
+		t.Fatal("Missing disposition notification")
+	}
+
+	if mdn.DispositionNotification.OriginalMessageID != "1234@local.machine.example" ||
+		mdn.DispositionNotification.FinalRecipient != "mary@example.net" ||
+		mdn.DispositionNotification.DispositionType != "displayed" {
+		t.Errorf("Wrong disposition notification. Got: %+v", *mdn.DispositionNotification)
+	}
+
+	if _, err := NewDispositionNotification(mdn, from, "manual-action/MDN-sent-manually; displayed"); err == nil {
+		t.Error("Expected error for email without Disposition-Notification-To")
+	}
+}
+
+var mdnRequestExample = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: Saying Hello
+Date: Fri, 21 Nov 1997 09:55:06 -0600
+Message-ID: <1234@local.machine.example>
+Disposition-Notification-To: John Doe <jdoe@machine.example>
+
+This is a message just to say hello.
+`
+
+var mdnExample = `From: Mary Smith <mary@example.net>
+To: John Doe <jdoe@machine.example>
+Subject: Read: Saying Hello
+Date: Fri, 21 Nov 1997 10:01:10 -0600
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=disposition-notification; boundary="RAA14128.773615766/example.net"
+
+--RAA14128.773615766/example.net
+Content-Type: text/plain
+
+The message was displayed.
+
+--RAA14128.773615766/example.net
+Content-Type: message/disposition-notification
+
+Reporting-UA: mua.example.net; Example Mail 1.0
+Original-Recipient: rfc822;mary@example.net
+Final-Recipient: rfc822;mary@example.net
+Original-Message-ID: <1234@local.machine.example>
+Disposition: manual-action/MDN-sent-manually; displayed
+
+--RAA14128.773615766/example.net--
+`
@@ -0,0 +1,289 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	msgPropertiesStream     = "__properties_version1.0"
+	msgRecipientPrefix      = "__recip_version1.0_#"
+	msgAttachmentPrefix     = "__attach_version1.0_#"
+	msgEmbeddedMessage      = "__substg1.0_3701000D"
+	msgTopLevelHeaderSize   = 32
+	msgEmbeddedHeaderSize   = 24
+	msgSubStorageHeaderSize = 8
+
+	msgRecipientCc  = 2
+	msgRecipientBcc = 3
+)
+
+// ParseMSG parses an Outlook .msg file (see MS-OXMSG) into an Email. The header fields are taken from the transport
+// headers of received messages or from the MAPI properties of the message. Attachments referenced from the html
+// body by their content id become embedded files, attached Outlook messages are parsed into EmbeddedMessages.
+func ParseMSG(r io.ReaderAt) (email Email, err error) {
+	f, err := openCFB(r)
+	if err != nil {
+		return
+	}
+
+	return f.parseMessage(0, msgTopLevelHeaderSize)
+}
+
+func (f *cfbFile) parseMessage(storage int, headerSize int) (email Email, err error) {
+	// directory entries of broken files may form cycles
+	if f.parsed[storage] {
+		return email, errInvalidCFB
+	}
+
+	f.parsed[storage] = true
+	children := f.children(storage)
+
+	props, err := f.msgProperties(children, headerSize)
+	if err != nil {
+		return
+	}
+
+	if headers := mapiString(findMAPIProperty(props, mapiTransportHeaders)); strings.TrimSpace(headers) != "" {
+		msg, err := mail.ReadMessage(strings.NewReader(strings.TrimRight(headers, "\r\n") + "\r\n\r\n"))
+		if err == nil {
+			if e, err := createEmailFromHeader(msg.Header); err == nil {
+				email = e
+			}
+		}
+	}
+
+	if email.Subject == "" {
+		email.Subject = mapiString(findMAPIProperty(props, mapiSubject))
+	}
+
+	if email.From == nil {
+		if from := msgAddress(props, mapiSenderName, mapiSenderSMTPAddress, mapiSenderEmailAddress); from != nil {
+			email.From = []*mail.Address{from}
+		} else if from := msgAddress(props, mapiSentRepresentingName, mapiSentRepresentingEmail); from != nil {
+			email.From = []*mail.Address{from}
+		}
+	}
+
+	if email.Date.IsZero() {
+		for _, id := range []uint16{mapiClientSubmitTime, mapiMessageDeliveryTime} {
+			if date, ok := findMAPIProperty(props, id).(time.Time); ok {
+				email.Date = date
+				break
+			}
+		}
+	}
+
+	if email.MessageID == "" {
+		email.MessageID = strings.Trim(mapiString(findMAPIProperty(props, mapiInternetMessageID)), "<>")
+	}
+
+	if email.InReplyTo == nil {
+		if inReplyTo := strings.Trim(mapiString(findMAPIProperty(props, mapiInReplyTo)), "<>"); inReplyTo != "" {
+			email.InReplyTo = []string{inReplyTo}
+		}
+	}
+
+	email.TextBody = mapiString(findMAPIProperty(props, mapiBody))
+	email.HTMLBody = mapiString(findMAPIProperty(props, mapiBodyHTML))
+
+	if email.HTMLBody == "" || email.TextBody == "" {
+		html, text := decodeRTFBody(mapiBytes(findMAPIProperty(props, mapiRTFCompressed)))
+		if email.HTMLBody == "" {
+			email.HTMLBody = html
+		}
+
+		if email.TextBody == "" {
+			email.TextBody = text
+		}
+	}
+
+	if err = f.parseMSGRecipients(children, &email); err != nil {
+		return
+	}
+
+	if err = f.parseMSGAttachments(children, &email); err != nil {
+		return
+	}
+
+	if err = decodeCalendarAttachments(&email); err != nil {
+		return
+	}
+
+	err = decodeContactAttachments(&email)
+
+	return
+}
+
+// msgProperties reads the properties stream of the storage. Variable length values are read from their streams,
+// multi-valued properties are skipped and named properties are not resolved.
+func (f *cfbFile) msgProperties(children map[string]int, headerSize int) ([]MAPIProperty, error) {
+	i, ok := children[msgPropertiesStream]
+	if !ok {
+		return nil, errInvalidCFB
+	}
+
+	data, err := f.stream(f.entries[i])
+	if err != nil {
+		return nil, err
+	}
+
+	var props []MAPIProperty
+	for off := headerSize; off+16 <= len(data); off += 16 {
+		tag := binary.LittleEndian.Uint32(data[off:])
+		p := MAPIProperty{ID: uint16(tag >> 16), Type: uint16(tag)}
+
+		switch {
+		case p.Type&mapiMultiValued != 0 || p.Type == mapiTypeObject:
+			continue
+		case isVariableLengthMAPIType(p.Type):
+			j, ok := children[fmt.Sprintf("__substg1.0_%08X", tag)]
+			if !ok || f.entries[j].typ != cfbTypeStream {
+				continue
+			}
+
+			value, err := f.stream(f.entries[j])
+			if err != nil {
+				return nil, err
+			}
+
+			p.Value = decodeMAPIValue(p.Type, value)
+		default:
+			p.Value = decodeMAPIValue(p.Type, data[off+8:off+16])
+		}
+
+		props = append(props, p)
+	}
+
+	return props, nil
+}
+
+func (f *cfbFile) parseMSGRecipients(children map[string]int, email *Email) error {
+	var to, cc, bcc []*mail.Address
+	for _, name := range sortedChildren(children, msgRecipientPrefix) {
+		i := children[name]
+		props, err := f.msgProperties(f.children(i), msgSubStorageHeaderSize)
+		if err != nil {
+			return err
+		}
+
+		address := msgAddress(props, mapiDisplayName, mapiSMTPAddress, mapiEmailAddress)
+		if address == nil {
+			continue
+		}
+
+		typ, _ := findMAPIProperty(props, mapiRecipientType).(int64)
+		switch typ {
+		case msgRecipientCc:
+			cc = append(cc, address)
+		case msgRecipientBcc:
+			bcc = append(bcc, address)
+		default:
+			to = append(to, address)
+		}
+	}
+
+	// the transport headers take precedence, except for Bcc which they don't contain
+	if email.To == nil {
+		email.To = to
+	}
+
+	if email.Cc == nil {
+		email.Cc = cc
+	}
+
+	if email.Bcc == nil {
+		email.Bcc = bcc
+	}
+
+	return nil
+}
+
+func (f *cfbFile) parseMSGAttachments(children map[string]int, email *Email) error {
+	for _, name := range sortedChildren(children, msgAttachmentPrefix) {
+		i := children[name]
+		atChildren := f.children(i)
+
+		if j, ok := atChildren[msgEmbeddedMessage]; ok && f.entries[j].typ == cfbTypeStorage {
+			embedded, err := f.parseMessage(j, msgEmbeddedHeaderSize)
+			if err != nil {
+				return err
+			}
+
+			email.EmbeddedMessages = append(email.EmbeddedMessages, embedded)
+			continue
+		}
+
+		props, err := f.msgProperties(atChildren, msgSubStorageHeaderSize)
+		if err != nil {
+			return err
+		}
+
+		filename := mapiString(findMAPIProperty(props, mapiAttachLongFilename))
+		for _, id := range []uint16{mapiAttachFilename, mapiDisplayName} {
+			if filename == "" {
+				filename = mapiString(findMAPIProperty(props, id))
+			}
+		}
+
+		contentType := mapiString(findMAPIProperty(props, mapiAttachMimeTag))
+		if contentType == "" {
+			contentType = contentTypeByFilename(filename)
+		}
+
+		data := bytes.NewReader(mapiBytes(findMAPIProperty(props, mapiAttachDataBinary)))
+
+		cid := strings.Trim(mapiString(findMAPIProperty(props, mapiAttachContentID)), "<>")
+		if cid != "" && strings.Contains(email.HTMLBody, "cid:"+cid) {
+			email.EmbeddedFiles = append(email.EmbeddedFiles, EmbeddedFile{
+				CID:         cid,
+				Location:    mapiString(findMAPIProperty(props, mapiAttachContentLocation)),
+				ContentType: contentType,
+				Data:        data,
+			})
+
+			continue
+		}
+
+		email.Attachments = append(email.Attachments, Attachment{
+			Filename:    filename,
+			ContentType: contentType,
+			Data:        data,
+		})
+	}
+
+	return nil
+}
+
+// msgAddress returns the address from the display name property and the first address property containing an
+// email address
+func msgAddress(props []MAPIProperty, nameID uint16, addressIDs ...uint16) *mail.Address {
+	for _, id := range addressIDs {
+		address := mapiString(findMAPIProperty(props, id))
+		if strings.Contains(address, "@") {
+			return &mail.Address{Name: mapiString(findMAPIProperty(props, nameID)), Address: address}
+		}
+	}
+
+	return nil
+}
+
+// sortedChildren returns the names of the entries with the prefix in order
+func sortedChildren(children map[string]int, prefix string) []string {
+	var names []string
+	for name := range children {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
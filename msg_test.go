@@ -0,0 +1,383 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestParseMSG(t *testing.T) {
+	e, err := ParseMSG(bytes.NewReader(msgExample()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Subject != "Quarterly report" {
+		t.Errorf("Wrong subject. Expected: %s, Got: %s", "Quarterly report", e.Subject)
+	}
+
+	if !assertAddressListEq([]mail.Address{{Name: "John Doe", Address: "john@example.com"}}, dereferenceAddressList(e.From)) {
+		t.Errorf("Wrong From. Expected: %v, Got: %v", []mail.Address{{Name: "John Doe", Address: "john@example.com"}}, dereferenceAddressList(e.From))
+	}
+
+	if !assertAddressListEq([]mail.Address{{Name: "Jane Doe", Address: "jane@example.com"}}, dereferenceAddressList(e.To)) {
+		t.Errorf("Wrong To. Expected: %v, Got: %v", []mail.Address{{Name: "Jane Doe", Address: "jane@example.com"}}, dereferenceAddressList(e.To))
+	}
+
+	if !assertAddressListEq([]mail.Address{{Name: "Bob", Address: "bob@example.com"}}, dereferenceAddressList(e.Cc)) {
+		t.Errorf("Wrong Cc. Expected: %v, Got: %v", []mail.Address{{Name: "Bob", Address: "bob@example.com"}}, dereferenceAddressList(e.Cc))
+	}
+
+	if !assertAddressListEq([]mail.Address{{Name: "Boss", Address: "boss@example.com"}}, dereferenceAddressList(e.Bcc)) {
+		t.Errorf("Wrong Bcc. Expected: %v, Got: %v", []mail.Address{{Name: "Boss", Address: "boss@example.com"}}, dereferenceAddressList(e.Bcc))
+	}
+
+	if date := time.Date(2019, 3, 4, 10, 30, 0, 0, time.UTC); !e.Date.Equal(date) {
+		t.Errorf("Wrong date. Expected: %s, Got: %s", date, e.Date)
+	}
+
+	if e.MessageID != "msg1@example.com" {
+		t.Errorf("Wrong message id. Expected: %s, Got: %s", "msg1@example.com", e.MessageID)
+	}
+
+	if e.TextBody != "Hello,\nsee attached." {
+		t.Errorf("Wrong text body. Got: %s", e.TextBody)
+	}
+
+	if e.HTMLBody != `<p>Hello <img src="cid:logo@example.com"></p>` {
+		t.Errorf("Wrong html body. Got: %s", e.HTMLBody)
+	}
+
+	if len(e.Attachments) != 1 {
+		t.Fatalf("Wrong number of attachments. Expected: 1, Got: %v", len(e.Attachments))
+	}
+
+	data, _ := ioutil.ReadAll(e.Attachments[0].Data)
+	if e.Attachments[0].Filename != "report.txt" || e.Attachments[0].ContentType != "text/plain" || string(data) != "Revenue: 100" {
+		t.Errorf("Wrong attachment. Got: %+v with data %s", e.Attachments[0], data)
+	}
+
+	if len(e.EmbeddedFiles) != 1 || e.EmbeddedFiles[0].CID != "logo@example.com" || e.EmbeddedFiles[0].ContentType != "image/png" {
+		t.Errorf("Wrong embedded files. Got: %+v", e.EmbeddedFiles)
+	}
+
+	if len(e.EmbeddedMessages) != 1 {
+		t.Fatalf("Wrong number of embedded messages. Expected: 1, Got: %v", len(e.EmbeddedMessages))
+	}
+
+	embedded := e.EmbeddedMessages[0]
+	if embedded.Subject != "Original message" || embedded.MessageID != "orig@example.com" || embedded.TextBody != "Original text" {
+		t.Errorf("Wrong embedded message. Got: %+v", embedded)
+	}
+
+	if embedded.HTMLBody != "<p>Original</p>" {
+		t.Errorf("Wrong embedded html body. Expected: %s, Got: %s", "<p>Original</p>", embedded.HTMLBody)
+	}
+
+	if !assertAddressListEq([]mail.Address{{Name: "Alice", Address: "alice@example.com"}}, dereferenceAddressList(embedded.From)) {
+		t.Errorf("Wrong Embedded From. Expected: %v, Got: %v", []mail.Address{{Name: "Alice", Address: "alice@example.com"}}, dereferenceAddressList(embedded.From))
+	}
+}
+
+func TestParseMSGInvalid(t *testing.T) {
+	if _, err := ParseMSG(strings.NewReader(strings.Repeat("not an Outlook message", 30))); err == nil {
+		t.Error("Expected error for invalid file")
+	}
+
+	// truncated file
+	if _, err := ParseMSG(bytes.NewReader(msgExample()[:1024])); err == nil {
+		t.Error("Expected error for truncated file")
+	}
+
+	// DIFAT sector listing itself as the next one
+	difatLoop := cfbTestHeader()
+	binary.LittleEndian.PutUint32(difatLoop[0x2C:], 0xFFFF)
+	binary.LittleEndian.PutUint32(difatLoop[0x44:], 0)
+	binary.LittleEndian.PutUint32(difatLoop[0x48:], 0xFFFFFFFF)
+	difatLoop = append(difatLoop, make([]byte, 512)...)
+	if _, err := ParseMSG(bytes.NewReader(difatLoop)); err != errInvalidCFB {
+		t.Errorf("Wrong error for DIFAT cycle. Expected: %v, Got: %v", errInvalidCFB, err)
+	}
+
+	// directory chain looping back to its start
+	chainLoop := cfbTestHeader()
+	binary.LittleEndian.PutUint32(chainLoop[0x2C:], 1)
+	binary.LittleEndian.PutUint32(chainLoop[0x30:], 1)
+	binary.LittleEndian.PutUint32(chainLoop[0x4C:], 0)
+	fat := make([]byte, 512)
+	binary.LittleEndian.PutUint32(fat[0:], 0xFFFFFFFD)
+	binary.LittleEndian.PutUint32(fat[4:], 2)
+	binary.LittleEndian.PutUint32(fat[8:], 1)
+	chainLoop = append(chainLoop, fat...)
+	chainLoop = append(chainLoop, make([]byte, 2*512)...)
+	if _, err := ParseMSG(bytes.NewReader(chainLoop)); err != errInvalidCFB {
+		t.Errorf("Wrong error for sector chain cycle. Expected: %v, Got: %v", errInvalidCFB, err)
+	}
+}
+
+// cfbTestHeader returns the header of a version 3 compound file without FAT, DIFAT or mini FAT sectors
+func cfbTestHeader() []byte {
+	header := make([]byte, 512)
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[0x1A:], 3)
+	binary.LittleEndian.PutUint16(header[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[0x1E:], 9)
+	binary.LittleEndian.PutUint16(header[0x20:], 6)
+	binary.LittleEndian.PutUint32(header[0x30:], cfbEndOfChain)
+	binary.LittleEndian.PutUint32(header[0x38:], 4096)
+	binary.LittleEndian.PutUint32(header[0x3C:], cfbEndOfChain)
+	binary.LittleEndian.PutUint32(header[0x44:], cfbEndOfChain)
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(header[0x4C+i*4:], cfbNoStream)
+	}
+
+	return header
+}
+
+type msgTestProperty struct {
+	tag   uint32
+	value interface{}
+}
+
+func msgExample() []byte {
+	recipient := func(typ int32, name, address string) []*cfbTestEntry {
+		return msgTestStorage(8,
+			msgTestProperty{0x3001001F, name},
+			msgTestProperty{0x39FE001F, address},
+			msgTestProperty{0x0C150003, typ},
+		)
+	}
+
+	embedded := &cfbTestEntry{name: "__substg1.0_3701000D", storage: true, children: msgTestStorage(24,
+		msgTestProperty{0x0037001F, "Subject from properties"},
+		msgTestProperty{0x007D001F, "From: Alice <alice@example.com>\r\nTo: john@example.com\r\nSubject: Original message\r\nMessage-ID: <orig@example.com>\r\n"},
+		msgTestProperty{0x1000001F, "Original text"},
+		msgTestProperty{0x10090102, compressRTF(`{\rtf1\ansi\fromhtml1 {\*\htmltag64 <p>}Original\htmlrtf\par\htmlrtf0{\*\htmltag72 </p>}}`)},
+	)}
+
+	root := msgTestStorage(32,
+		msgTestProperty{0x0037001F, "Quarterly report"},
+		msgTestProperty{0x0C1A001F, "John Doe"},
+		msgTestProperty{0x5D01001F, "john@example.com"},
+		msgTestProperty{0x00390040, time.Date(2019, 3, 4, 10, 30, 0, 0, time.UTC)},
+		msgTestProperty{0x1000001F, "Hello,\nsee attached."},
+		msgTestProperty{0x10130102, []byte(`<p>Hello <img src="cid:logo@example.com"></p>`)},
+		msgTestProperty{0x1035001F, "<msg1@example.com>"},
+	)
+
+	root = append(root,
+		&cfbTestEntry{name: "__recip_version1.0_#00000000", storage: true, children: recipient(1, "Jane Doe", "jane@example.com")},
+		&cfbTestEntry{name: "__recip_version1.0_#00000001", storage: true, children: recipient(2, "Bob", "bob@example.com")},
+		&cfbTestEntry{name: "__recip_version1.0_#00000002", storage: true, children: recipient(3, "Boss", "boss@example.com")},
+		&cfbTestEntry{name: "__attach_version1.0_#00000000", storage: true, children: msgTestStorage(8,
+			msgTestProperty{0x3707001F, "report.txt"},
+			msgTestProperty{0x370E001F, "text/plain"},
+			msgTestProperty{0x37010102, []byte("Revenue: 100")},
+		)},
+		&cfbTestEntry{name: "__attach_version1.0_#00000001", storage: true, children: msgTestStorage(8,
+			msgTestProperty{0x3707001F, "logo.png"},
+			msgTestProperty{0x3712001F, "logo@example.com"},
+			msgTestProperty{0x37010102, []byte("\x89PNG")},
+		)},
+		&cfbTestEntry{name: "__attach_version1.0_#00000002", storage: true, children: []*cfbTestEntry{
+			embedded,
+			{name: "__properties_version1.0", data: make([]byte, 8)},
+		}},
+	)
+
+	return buildCFB(root)
+}
+
+// msgTestStorage returns the properties stream and value streams of a message, recipient or attachment storage
+func msgTestStorage(headerSize int, props ...msgTestProperty) []*cfbTestEntry {
+	stream := make([]byte, headerSize)
+	var entries []*cfbTestEntry
+
+	for _, p := range props {
+		entry := make([]byte, 16)
+		binary.LittleEndian.PutUint32(entry, p.tag)
+		binary.LittleEndian.PutUint32(entry[4:], 6)
+
+		var data []byte
+		switch v := p.value.(type) {
+		case string:
+			for _, u := range utf16.Encode([]rune(v + "\x00")) {
+				data = append(data, byte(u), byte(u>>8))
+			}
+		case []byte:
+			data = v
+		case int32:
+			binary.LittleEndian.PutUint32(entry[8:], uint32(v))
+		case time.Time:
+			binary.LittleEndian.PutUint64(entry[8:], uint64(v.UnixNano()/100+116444736000000000))
+		}
+
+		if data != nil {
+			binary.LittleEndian.PutUint32(entry[8:], uint32(len(data)))
+			entries = append(entries, &cfbTestEntry{name: fmt.Sprintf("__substg1.0_%08X", p.tag), data: data})
+		}
+
+		stream = append(stream, entry...)
+	}
+
+	return append([]*cfbTestEntry{{name: "__properties_version1.0", data: stream}}, entries...)
+}
+
+type cfbTestEntry struct {
+	name     string
+	data     []byte
+	storage  bool
+	children []*cfbTestEntry
+}
+
+// buildCFB writes a version 3 compound file with all streams in the mini stream
+func buildCFB(children []*cfbTestEntry) []byte {
+	type dirEntry struct {
+		name         string
+		typ          byte
+		child, right uint32
+		start        uint32
+		size         int
+	}
+
+	var dir []dirEntry
+	var mini []byte
+	var miniFAT []uint32
+
+	var add func(e *cfbTestEntry, typ byte) int
+	add = func(e *cfbTestEntry, typ byte) int {
+		i := len(dir)
+		dir = append(dir, dirEntry{name: e.name, typ: typ, child: cfbNoStream, right: cfbNoStream, start: cfbEndOfChain})
+
+		if typ == cfbTypeStream && len(e.data) > 0 {
+			n := (len(e.data) + 63) / 64
+			dir[i].start = uint32(len(miniFAT))
+			dir[i].size = len(e.data)
+			for k := 0; k < n; k++ {
+				next := uint32(len(miniFAT) + 1)
+				if k == n-1 {
+					next = cfbEndOfChain
+				}
+
+				miniFAT = append(miniFAT, next)
+			}
+
+			padded := make([]byte, n*64)
+			copy(padded, e.data)
+			mini = append(mini, padded...)
+		}
+
+		prev := -1
+		for _, c := range e.children {
+			typ := byte(cfbTypeStream)
+			if c.storage {
+				typ = cfbTypeStorage
+			}
+
+			j := add(c, typ)
+			if prev == -1 {
+				dir[i].child = uint32(j)
+			} else {
+				dir[prev].right = uint32(j)
+			}
+
+			prev = j
+		}
+
+		return i
+	}
+
+	add(&cfbTestEntry{name: "Root Entry", children: children}, cfbTypeRoot)
+
+	sectors := func(n int) int {
+		return (n + 511) / 512
+	}
+
+	var fat []uint32
+	chain := func(n int) uint32 {
+		start := uint32(len(fat))
+		for k := 0; k < n; k++ {
+			next := uint32(len(fat) + 1)
+			if k == n-1 {
+				next = cfbEndOfChain
+			}
+
+			fat = append(fat, next)
+		}
+
+		return start
+	}
+
+	dir[0].start = chain(sectors(len(mini)))
+	dir[0].size = len(mini)
+	miniFATStart := chain(sectors(len(miniFAT) * 4))
+	dirStart := chain(sectors(len(dir) * 128))
+	fatSector := uint32(len(fat))
+	fat = append(fat, 0xFFFFFFFD)
+	for len(fat) < 128 {
+		fat = append(fat, cfbNoStream)
+	}
+
+	b := make([]byte, 512)
+	copy(b, cfbSignature)
+	binary.LittleEndian.PutUint16(b[0x18:], 0x3E)
+	binary.LittleEndian.PutUint16(b[0x1A:], 3)
+	binary.LittleEndian.PutUint16(b[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(b[0x1E:], 9)
+	binary.LittleEndian.PutUint16(b[0x20:], 6)
+	binary.LittleEndian.PutUint32(b[0x2C:], 1)
+	binary.LittleEndian.PutUint32(b[0x30:], dirStart)
+	binary.LittleEndian.PutUint32(b[0x38:], 4096)
+	binary.LittleEndian.PutUint32(b[0x3C:], miniFATStart)
+	binary.LittleEndian.PutUint32(b[0x40:], uint32(sectors(len(miniFAT)*4)))
+	binary.LittleEndian.PutUint32(b[0x44:], cfbEndOfChain)
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(b[0x4C+i*4:], cfbNoStream)
+	}
+	binary.LittleEndian.PutUint32(b[0x4C:], fatSector)
+
+	pad := func(data []byte) []byte {
+		return append(data, make([]byte, sectors(len(data))*512-len(data))...)
+	}
+
+	b = append(b, pad(mini)...)
+	b = append(b, pad(uint32Bytes(miniFAT))...)
+
+	var entries []byte
+	for _, d := range dir {
+		entry := make([]byte, 128)
+		name := utf16.Encode([]rune(d.name + "\x00"))
+		for i, u := range name {
+			binary.LittleEndian.PutUint16(entry[i*2:], u)
+		}
+
+		binary.LittleEndian.PutUint16(entry[0x40:], uint16(len(name)*2))
+		entry[0x42] = d.typ
+		entry[0x43] = 1
+		binary.LittleEndian.PutUint32(entry[0x44:], cfbNoStream)
+		binary.LittleEndian.PutUint32(entry[0x48:], d.right)
+		binary.LittleEndian.PutUint32(entry[0x4C:], d.child)
+		binary.LittleEndian.PutUint32(entry[0x74:], d.start)
+		binary.LittleEndian.PutUint32(entry[0x78:], uint32(d.size))
+		entries = append(entries, entry...)
+	}
+
+	b = append(b, pad(entries)...)
+
+	return append(b, uint32Bytes(fat)...)
+}
+
+func uint32Bytes(s []uint32) []byte {
+	b := make([]byte, len(s)*4)
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(b[i*4:], v)
+	}
+
+	return b
+}
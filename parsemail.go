@@ -9,6 +9,7 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/mail"
+	"net/textproto"
 	"strings"
 	"time"
 )
@@ -16,16 +17,28 @@ import (
 const contentTypeMultipartMixed = "multipart/mixed"
 const contentTypeMultipartAlternative = "multipart/alternative"
 const contentTypeMultipartRelated = "multipart/related"
+const contentTypeMultipartReport = "multipart/report"
 const contentTypeTextHtml = "text/html"
 const contentTypeTextPlain = "text/plain"
+const contentTypeTextCalendar = "text/calendar"
+const contentTypeTextVCard = "text/vcard"
+const contentTypeTextXVCard = "text/x-vcard"
 
 // Parse an email message read from io.Reader into parsemail.Email struct
 func Parse(r io.Reader) (email Email, err error) {
-	msg, err := mail.ReadMessage(r)
+	return Parser{}.Parse(r)
+}
+
+func (s *parseState) parse(r io.Reader) (email Email, err error) {
+	msg, err := mail.ReadMessage(&limitedReader{r: r, s: s})
 	if err != nil {
 		return
 	}
 
+	if e, ok := s.indexedEntity(); ok {
+		referenceHeader(msg.Header, e.header)
+	}
+
 	email, err = createEmailFromHeader(msg.Header)
 	if err != nil {
 		return
@@ -37,21 +50,97 @@ func Parse(r io.Reader) (email Email, err error) {
 		return
 	}
 
-	switch contentType {
-	case contentTypeMultipartMixed:
-		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, err = parseMultipartMixed(msg.Body, params["boundary"])
-	case contentTypeMultipartAlternative:
-		email.TextBody, email.HTMLBody, email.EmbeddedFiles, err = parseMultipartAlternative(msg.Body, params["boundary"])
-	case contentTypeMultipartRelated:
-		email.TextBody, email.HTMLBody, email.EmbeddedFiles, err = parseMultipartRelated(msg.Body, params["boundary"])
-	case contentTypeTextPlain:
-		message, _ := ioutil.ReadAll(msg.Body)
-		email.TextBody = strings.TrimSuffix(string(message[:]), "\n")
-	case contentTypeTextHtml:
-		message, _ := ioutil.ReadAll(msg.Body)
-		email.HTMLBody = strings.TrimSuffix(string(message[:]), "\n")
-	default:
-		email.Content, err = decodeContent(msg.Body, msg.Header.Get("Content-Transfer-Encoding"))
+	// the body of the message is handed to the content handlers like the body parts
+	header := textproto.MIMEHeader(msg.Header)
+	s.base = entityBase("", header)
+	handled, err := s.handleEntity(header, msg.Body, entityFileName(header), contentType, params, &email)
+	if err != nil {
+		return
+	}
+
+	if !handled {
+		switch contentType {
+		case contentTypeMultipartMixed:
+			err = s.parseMultipartMixed(msg.Body, params["boundary"], &email)
+		case contentTypeMultipartAlternative:
+			err = s.parseMultipartAlternative(msg.Body, params["boundary"], &email)
+		case contentTypeMultipartRelated:
+			err = s.parseMultipartRelated(msg.Body, params["boundary"], &email)
+		case contentTypeMultipartReport:
+			var reports []reportPart
+			reports, err = s.parseMultipartReport(msg.Body, params["boundary"], &email)
+			if err != nil {
+				return
+			}
+
+			switch strings.ToLower(params["report-type"]) {
+			case reportTypeDeliveryStatus:
+				email.DeliveryStatus = parseDeliveryStatus(reports)
+			case reportTypeDispositionNotification:
+				email.DispositionNotification = parseDispositionNotification(reports)
+			case reportTypeFeedbackReport:
+				email.FeedbackReport, err = s.parseFeedbackReport(reports)
+			}
+		case contentTypeTextPlain:
+			var message string
+			if message, err = s.readText(msg.Body); err != nil {
+				return
+			}
+
+			email.TextBody = strings.TrimSuffix(decodeTextBody(message, params), "\n")
+		case contentTypeTextHtml:
+			var message string
+			if message, err = s.readText(msg.Body); err != nil {
+				return
+			}
+
+			email.HTMLBody = strings.TrimSuffix(message, "\n")
+			email.HTMLBase = s.base
+		case contentTypeTextCalendar:
+			email.Content, err = s.decodeContent(msg.Body, msg.Header.Get("Content-Transfer-Encoding"))
+			if err != nil {
+				return
+			}
+
+			email.Calendars, err = parseCalendarData(email.Content)
+		case contentTypeTextVCard, contentTypeTextXVCard:
+			email.Content, err = s.decodeContent(msg.Body, msg.Header.Get("Content-Transfer-Encoding"))
+			if err != nil {
+				return
+			}
+
+			email.Contacts, err = parseContactData(email.Content)
+		default:
+			email.Content, err = s.decodeContent(msg.Body, msg.Header.Get("Content-Transfer-Encoding"))
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	if err = s.ctx.Err(); err != nil {
+		return
+	}
+
+	if err = s.expand(extractInlineAttachments(&email, s.limits.MaxPartBytes)); err != nil {
+		return
+	}
+
+	if err = s.decodeTNEFAttachments(&email); err != nil {
+		return
+	}
+
+	if err = decodeCalendarAttachments(&email); err != nil {
+		return
+	}
+
+	if err = decodeContactAttachments(&email); err != nil {
+		return
+	}
+
+	if email.DeliveryStatus == nil && isBounce(email) {
+		email.DeliveryStatus = guessDeliveryStatus(email)
 	}
 
 	return
@@ -78,6 +167,9 @@ func createEmailFromHeader(header mail.Header) (email Email, err error) {
 	email.InReplyTo = hp.parseMessageIdList(header.Get("In-Reply-To"))
 	email.References = hp.parseMessageIdList(header.Get("References"))
 	email.ResentDate = hp.parseTime(header.Get("Resent-Date"))
+	email.DispositionNotificationTo = hp.parseAddressList(header.Get("Disposition-Notification-To"))
+	email.List = parseListInfo(header)
+	email.Autocrypt = parseAutocrypt(header, email.From)
 
 	if hp.err != nil {
 		err = hp.err
@@ -103,7 +195,13 @@ func parseContentType(contentTypeHeader string) (contentType string, params map[
 	return mime.ParseMediaType(contentTypeHeader)
 }
 
-func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody string, embeddedFiles []EmbeddedFile, err error) {
+func (s *parseState) parseMultipartRelated(msg io.Reader, boundary string, email *Email) error {
+	if err := s.enterMultipart(); err != nil {
+		return err
+	}
+
+	defer s.leaveMultipart()
+
 	pmr := multipart.NewReader(msg, boundary)
 	for {
 		part, err := pmr.NextPart()
@@ -111,56 +209,79 @@ func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody s
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return textBody, htmlBody, embeddedFiles, err
+			return err
+		}
+
+		if err := s.startPart(part); err != nil {
+			return err
 		}
 
 		contentType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
 		if err != nil {
-			return textBody, htmlBody, embeddedFiles, err
+			return err
+		}
+
+		if handled, err := s.handlePart(part, contentType, params, email); err != nil {
+			return err
+		} else if handled {
+			continue
 		}
 
 		switch contentType {
 		case contentTypeTextPlain:
-			ppContent, err := ioutil.ReadAll(part)
+			ppContent, err := s.readText(part)
 			if err != nil {
-				return textBody, htmlBody, embeddedFiles, err
+				return err
 			}
 
-			textBody += strings.TrimSuffix(string(ppContent[:]), "\n")
+			email.TextBody += strings.TrimSuffix(decodeTextBody(ppContent, params), "\n")
 		case contentTypeTextHtml:
-			ppContent, err := ioutil.ReadAll(part)
+			ppContent, err := s.readText(part)
 			if err != nil {
-				return textBody, htmlBody, embeddedFiles, err
+				return err
 			}
 
-			htmlBody += strings.TrimSuffix(string(ppContent[:]), "\n")
-		case contentTypeMultipartAlternative:
-			tb, hb, ef, err := parseMultipartAlternative(part, params["boundary"])
-			if err != nil {
-				return textBody, htmlBody, embeddedFiles, err
+			if email.HTMLBody == "" {
+				email.HTMLBase = s.base
 			}
 
-			htmlBody += hb
-			textBody += tb
-			embeddedFiles = append(embeddedFiles, ef...)
+			email.HTMLBody += strings.TrimSuffix(ppContent, "\n")
+		case contentTypeTextCalendar:
+			if err := s.parseCalendarPart(part, email); err != nil {
+				return err
+			}
+		case contentTypeTextVCard, contentTypeTextXVCard:
+			if err := s.parseContactPart(part, email); err != nil {
+				return err
+			}
+		case contentTypeMultipartAlternative:
+			if err := s.parseMultipartAlternative(part, params["boundary"], email); err != nil {
+				return err
+			}
 		default:
 			if isEmbeddedFile(part) {
-				ef, err := decodeEmbeddedFile(part)
+				ef, err := s.decodeEmbeddedFile(part)
 				if err != nil {
-					return textBody, htmlBody, embeddedFiles, err
+					return err
 				}
 
-				embeddedFiles = append(embeddedFiles, ef)
+				email.EmbeddedFiles = append(email.EmbeddedFiles, ef)
 			} else {
-				return textBody, htmlBody, embeddedFiles, fmt.Errorf("Can't process multipart/related inner mime type: %s", contentType)
+				return fmt.Errorf("Can't process multipart/related inner mime type: %s", contentType)
 			}
 		}
 	}
 
-	return textBody, htmlBody, embeddedFiles, err
+	return nil
 }
 
-func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBody string, embeddedFiles []EmbeddedFile, err error) {
+func (s *parseState) parseMultipartAlternative(msg io.Reader, boundary string, email *Email) error {
+	if err := s.enterMultipart(); err != nil {
+		return err
+	}
+
+	defer s.leaveMultipart()
+
 	pmr := multipart.NewReader(msg, boundary)
 	for {
 		part, err := pmr.NextPart()
@@ -168,110 +289,246 @@ func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBo
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return textBody, htmlBody, embeddedFiles, err
+			return err
+		}
+
+		if err := s.startPart(part); err != nil {
+			return err
 		}
 
 		contentType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
 		if err != nil {
-			return textBody, htmlBody, embeddedFiles, err
+			return err
+		}
+
+		if handled, err := s.handlePart(part, contentType, params, email); err != nil {
+			return err
+		} else if handled {
+			continue
 		}
 
 		switch contentType {
 		case contentTypeTextPlain:
-			ppContent, err := ioutil.ReadAll(part)
+			ppContent, err := s.readText(part)
 			if err != nil {
-				return textBody, htmlBody, embeddedFiles, err
+				return err
 			}
 
-			textBody += strings.TrimSuffix(string(ppContent[:]), "\n")
+			email.TextBody += strings.TrimSuffix(decodeTextBody(ppContent, params), "\n")
 		case contentTypeTextHtml:
-			ppContent, err := ioutil.ReadAll(part)
+			ppContent, err := s.readText(part)
 			if err != nil {
-				return textBody, htmlBody, embeddedFiles, err
+				return err
 			}
 
-			htmlBody += strings.TrimSuffix(string(ppContent[:]), "\n")
-		case contentTypeMultipartRelated:
-			tb, hb, ef, err := parseMultipartRelated(part, params["boundary"])
-			if err != nil {
-				return textBody, htmlBody, embeddedFiles, err
+			if email.HTMLBody == "" {
+				email.HTMLBase = s.base
 			}
 
-			htmlBody += hb
-			textBody += tb
-			embeddedFiles = append(embeddedFiles, ef...)
+			email.HTMLBody += strings.TrimSuffix(ppContent, "\n")
+		case contentTypeTextCalendar:
+			if err := s.parseCalendarPart(part, email); err != nil {
+				return err
+			}
+		case contentTypeTextVCard, contentTypeTextXVCard:
+			if err := s.parseContactPart(part, email); err != nil {
+				return err
+			}
+		case contentTypeMultipartRelated:
+			if err := s.parseMultipartRelated(part, params["boundary"], email); err != nil {
+				return err
+			}
 		default:
 			if isEmbeddedFile(part) {
-				ef, err := decodeEmbeddedFile(part)
+				ef, err := s.decodeEmbeddedFile(part)
 				if err != nil {
-					return textBody, htmlBody, embeddedFiles, err
+					return err
 				}
 
-				embeddedFiles = append(embeddedFiles, ef)
+				email.EmbeddedFiles = append(email.EmbeddedFiles, ef)
 			} else {
-				return textBody, htmlBody, embeddedFiles, fmt.Errorf("Can't process multipart/alternative inner mime type: %s", contentType)
+				return fmt.Errorf("Can't process multipart/alternative inner mime type: %s", contentType)
 			}
 		}
 	}
 
-	return textBody, htmlBody, embeddedFiles, err
+	return nil
 }
 
-func parseMultipartMixed(msg io.Reader, boundary string) (textBody, htmlBody string, attachments []Attachment, embeddedFiles []EmbeddedFile, err error) {
+func (s *parseState) parseMultipartMixed(msg io.Reader, boundary string, email *Email) error {
+	if err := s.enterMultipart(); err != nil {
+		return err
+	}
+
+	defer s.leaveMultipart()
+
 	mr := multipart.NewReader(msg, boundary)
 	for {
 		part, err := mr.NextPart()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, err
+			return err
+		}
+
+		if err := s.startPart(part); err != nil {
+			return err
 		}
 
 		contentType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
 		if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, err
+			return err
+		}
+
+		if handled, err := s.handlePart(part, contentType, params, email); err != nil {
+			return err
+		} else if handled {
+			continue
 		}
 
 		if contentType == contentTypeMultipartAlternative {
-			textBody, htmlBody, embeddedFiles, err = parseMultipartAlternative(part, params["boundary"])
-			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, err
+			if err := s.parseMultipartAlternative(part, params["boundary"], email); err != nil {
+				return err
 			}
 		} else if contentType == contentTypeMultipartRelated {
-			textBody, htmlBody, embeddedFiles, err = parseMultipartRelated(part, params["boundary"])
-			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, err
+			if err := s.parseMultipartRelated(part, params["boundary"], email); err != nil {
+				return err
 			}
 		} else if contentType == contentTypeTextPlain {
-			ppContent, err := ioutil.ReadAll(part)
+			ppContent, err := s.readText(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, err
+				return err
 			}
 
-			textBody += strings.TrimSuffix(string(ppContent[:]), "\n")
+			email.TextBody += strings.TrimSuffix(decodeTextBody(ppContent, params), "\n")
 		} else if contentType == contentTypeTextHtml {
-			ppContent, err := ioutil.ReadAll(part)
+			ppContent, err := s.readText(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, err
+				return err
+			}
+
+			if email.HTMLBody == "" {
+				email.HTMLBase = s.base
 			}
 
-			htmlBody += strings.TrimSuffix(string(ppContent[:]), "\n")
+			email.HTMLBody += strings.TrimSuffix(ppContent, "\n")
 		} else if isAttachment(part) {
-			at, err := decodeAttachment(part)
+			at, err := s.decodeAttachment(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, err
+				return err
 			}
 
-			attachments = append(attachments, at)
+			email.Attachments = append(email.Attachments, at)
+		} else if contentType == contentTypeTextCalendar {
+			if err := s.parseCalendarPart(part, email); err != nil {
+				return err
+			}
+		} else if contentType == contentTypeTextVCard || contentType == contentTypeTextXVCard {
+			if err := s.parseContactPart(part, email); err != nil {
+				return err
+			}
 		} else {
-			return textBody, htmlBody, attachments, embeddedFiles, fmt.Errorf("Unknown multipart/mixed nested mime type: %s", contentType)
+			return fmt.Errorf("Unknown multipart/mixed nested mime type: %s", contentType)
+		}
+	}
+
+	return nil
+}
+
+func (s *parseState) parseMultipartReport(msg io.Reader, boundary string, email *Email) (reports []reportPart, err error) {
+	if err := s.enterMultipart(); err != nil {
+		return reports, err
+	}
+
+	defer s.leaveMultipart()
+
+	mr := multipart.NewReader(msg, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return reports, err
+		}
+
+		if err := s.startPart(part); err != nil {
+			return reports, err
+		}
+
+		contentType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			return reports, err
+		}
+
+		if handled, err := s.handlePart(part, contentType, params, email); err != nil {
+			return reports, err
+		} else if handled {
+			continue
+		}
+
+		switch {
+		case contentType == contentTypeMultipartAlternative:
+			if err := s.parseMultipartAlternative(part, params["boundary"], email); err != nil {
+				return reports, err
+			}
+		case contentType == contentTypeTextPlain && len(reports) == 0:
+			ppContent, err := s.readText(part)
+			if err != nil {
+				return reports, err
+			}
+
+			email.TextBody += strings.TrimSuffix(decodeTextBody(ppContent, params), "\n")
+		case contentType == contentTypeTextHtml && len(reports) == 0:
+			ppContent, err := s.readText(part)
+			if err != nil {
+				return reports, err
+			}
+
+			if email.HTMLBody == "" {
+				email.HTMLBase = s.base
+			}
+
+			email.HTMLBody += strings.TrimSuffix(ppContent, "\n")
+		case isReportPart(part, contentType):
+			decoded, err := s.decodeContent(part, part.Header.Get("Content-Transfer-Encoding"))
+			if err != nil {
+				return reports, err
+			}
+
+			data, err := ioutil.ReadAll(decoded)
+			if err != nil {
+				return reports, err
+			}
+
+			reports = append(reports, reportPart{contentType: contentType, data: data})
+		case isAttachment(part):
+			at, err := s.decodeAttachment(part)
+			if err != nil {
+				return reports, err
+			}
+
+			email.Attachments = append(email.Attachments, at)
+		default:
+			return reports, fmt.Errorf("Can't process multipart/report inner mime type: %s", contentType)
 		}
 	}
 
-	return textBody, htmlBody, attachments, embeddedFiles, err
+	return reports, nil
+}
+
+// isReportPart reports whether a multipart/report part is a machine readable report or a returned message, as
+// opposed to an attached file
+func isReportPart(part *multipart.Part, contentType string) bool {
+	return strings.HasPrefix(contentType, "message/") || contentType == "text/rfc822-headers" ||
+		(strings.HasPrefix(contentType, "text/") && !isAttachment(part))
 }
 
 func decodeMimeSentence(s string) string {
+	// without encoded words the sentence is kept as it is, e.g. referencing a message held in memory
+	if !strings.Contains(s, "=?") {
+		return s
+	}
+
 	result := []string{}
 	ss := strings.Split(s, " ")
 
@@ -312,14 +569,19 @@ func isEmbeddedFile(part *multipart.Part) bool {
 	return part.Header.Get("Content-Transfer-Encoding") != ""
 }
 
-func decodeEmbeddedFile(part *multipart.Part) (ef EmbeddedFile, err error) {
+func (s *parseState) decodeEmbeddedFile(part *multipart.Part) (ef EmbeddedFile, err error) {
 	cid := decodeMimeSentence(part.Header.Get("Content-Id"))
-	decoded, err := decodeContent(part, part.Header.Get("Content-Transfer-Encoding"))
+	decoded, err := s.decodeContent(part, part.Header.Get("Content-Transfer-Encoding"))
 	if err != nil {
 		return
 	}
 
 	ef.CID = strings.Trim(cid, "<>")
+	if part.Header.Get("Content-Location") != "" {
+		// the base of the part is its Content-Location resolved against the enclosing entities
+		ef.Location = s.base
+	}
+
 	ef.Data = decoded
 	ef.ContentType = part.Header.Get("Content-Type")
 
@@ -330,9 +592,9 @@ func isAttachment(part *multipart.Part) bool {
 	return part.FileName() != ""
 }
 
-func decodeAttachment(part *multipart.Part) (at Attachment, err error) {
+func (s *parseState) decodeAttachment(part *multipart.Part) (at Attachment, err error) {
 	filename := decodeMimeSentence(part.FileName())
-	decoded, err := decodeContent(part, part.Header.Get("Content-Transfer-Encoding"))
+	decoded, err := s.decodeContent(part, part.Header.Get("Content-Transfer-Encoding"))
 	if err != nil {
 		return
 	}
@@ -354,20 +616,39 @@ func decodeContent(content io.Reader, encoding string) (io.Reader, error) {
 		}
 
 		return bytes.NewReader(b), nil
-	case "7bit":
+	case "", "7bit", "8bit", "binary":
 		dd, err := ioutil.ReadAll(content)
 		if err != nil {
 			return nil, err
 		}
 
 		return bytes.NewReader(dd), nil
-	case "":
-		return content, nil
+	case "x-uuencode", "x-uue", "uuencode":
+		return decodeUUEncoded(content)
 	default:
 		return nil, fmt.Errorf("unknown encoding: %s", encoding)
 	}
 }
 
+// readData reads all the data of an attachment or embedded file. If the reader can seek, it is rewound afterwards
+// so the data can be read again.
+func readData(r io.Reader) ([]byte, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := r.(io.Seeker); ok {
+		_, err = s.Seek(0, io.SeekStart)
+	}
+
+	return b, err
+}
+
 type headerParser struct {
 	header *mail.Header
 	err    error
@@ -451,9 +732,11 @@ type Attachment struct {
 	Data        io.Reader
 }
 
-// EmbeddedFile with content id, content type and data (as a io.Reader)
+// EmbeddedFile with content id, content location (resolved against the base of the enclosing entities), content type
+// and data (as a io.Reader)
 type EmbeddedFile struct {
 	CID         string
+	Location    string
 	ContentType string
 	Data        io.Reader
 }
@@ -482,12 +765,36 @@ type Email struct {
 	ResentBcc       []*mail.Address
 	ResentMessageID string
 
+	DispositionNotificationTo []*mail.Address
+
+	List *ListInfo
+
+	Autocrypt       *Autocrypt
+	AutocryptGossip []Autocrypt
+
 	ContentType string
-	Content io.Reader
+	Content     io.Reader
 
 	HTMLBody string
 	TextBody string
+	// HTMLBase is the base location of the html body, from the Content-Location of its part and of the enclosing
+	// entities, see RFC 2557
+	HTMLBase string
 
 	Attachments   []Attachment
 	EmbeddedFiles []EmbeddedFile
-}
\ No newline at end of file
+
+	DeliveryStatus          *DeliveryStatus
+	DispositionNotification *DispositionNotification
+	FeedbackReport          *FeedbackReport
+
+	Calendars []Calendar
+	Contacts  []Contact
+
+	TNEF *TNEF
+
+	EmbeddedMessages []Email
+
+	SMIME *SMIME
+	PGP   *PGP
+}
@@ -0,0 +1,389 @@
+package parsemail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const contentTypeMultipartEncrypted = "multipart/encrypted"
+
+const (
+	pgpSignedMessageBegin = "-----BEGIN PGP SIGNED MESSAGE-----"
+	pgpSignatureBegin     = "-----BEGIN PGP SIGNATURE-----"
+	pgpSignatureEnd       = "-----END PGP SIGNATURE-----"
+	pgpMessageBegin       = "-----BEGIN PGP MESSAGE-----"
+	pgpMessageEnd         = "-----END PGP MESSAGE-----"
+)
+
+var (
+	errInvalidPGPMIME = errors.New("invalid PGP/MIME message")
+	errPGPNoProvider  = errors.New("no OpenPGP provider")
+)
+
+// OpenPGPProvider verifies and decrypts OpenPGP data, e.g. using golang.org/x/crypto/openpgp or gpg. Signatures and
+// messages are passed ASCII armored, as found in emails.
+type OpenPGPProvider interface {
+	// Decrypt decrypts a message and returns the signatures of messages that are also signed
+	Decrypt(message []byte) (plaintext []byte, signatures []PGPSignature, err error)
+	// Verify checks a detached signature over the data, reporting invalid signatures in their Err
+	Verify(data []byte, signature []byte) []PGPSignature
+}
+
+// PGP with the security layers of a PGP/MIME (RFC 3156) or inline PGP message
+type PGP struct {
+	Signed    bool
+	Encrypted bool
+	// Inline is set when the signed or encrypted content was found in PGP blocks of the text body
+	Inline bool
+	// Unsigned is set when the text body has text outside of its inline PGP blocks which isn't covered by a signature
+	// of a PGP/MIME layer either
+	Unsigned   bool
+	Signatures []PGPSignature
+	// Err is the reason an inline encrypted block couldn't be decrypted, the block is kept in the text body
+	Err error
+}
+
+// PGPSignature with the signing key and the result of the verification of a signature, as reported by the
+// OpenPGPProvider
+type PGPSignature struct {
+	KeyID uint64
+	// Signer identifies the signing key, e.g. by its fingerprint or user id
+	Signer       string
+	CreationTime time.Time
+	// Err is the reason the signature is not valid, nil when verified
+	Err error
+}
+
+// Verified reports whether the message is signed and all signatures are valid. Messages with Unsigned text are not
+// verified.
+func (p PGP) Verified() bool {
+	if !p.Signed || p.Unsigned || len(p.Signatures) == 0 {
+		return false
+	}
+
+	for _, signature := range p.Signatures {
+		if signature.Err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParsePGP parses an email message which may be signed (multipart/signed) and/or encrypted (multipart/encrypted) as
+// described by RFC 3156, handing signatures and encrypted data to the provider. The protected entity is parsed into
+// the bodies and attachments of the email, with the header fields of the outer message. Cleartext signed and
+// encrypted blocks of the text body are verified and decrypted in place. Autocrypt-Gossip headers of decrypted
+// entities are reported in AutocryptGossip.
+func ParsePGP(r io.Reader, provider OpenPGPProvider) (email Email, err error) {
+	return Parser{}.ParsePGP(r, provider)
+}
+
+// ParsePGP parses an email message like the package ParsePGP, within the limits and with the content handlers.
+// Decrypted and unwrapped entities count towards the size of the message and security layers towards its nesting.
+func (p Parser) ParsePGP(r io.Reader, provider OpenPGPProvider) (email Email, err error) {
+	return p.ParsePGPContext(context.Background(), r, provider)
+}
+
+// ParsePGPContext parses an email message like ParsePGP, returning ctx.Err() once the context is done. Cancellation
+// is also checked before each security layer and inline block is handed to the provider.
+func (p Parser) ParsePGPContext(ctx context.Context, r io.Reader, provider OpenPGPProvider) (email Email, err error) {
+	s := &parseState{ctx: ctx, limits: p.Limits, handlers: p.Handlers}
+
+	email, err = s.parsePGP(r, provider)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return Email{}, ctxErr
+	}
+
+	return
+}
+
+func (s *parseState) parsePGP(r io.Reader, provider OpenPGPProvider) (email Email, err error) {
+	raw, err := s.readMessage(r)
+	if err != nil {
+		return
+	}
+
+	info := &PGP{}
+	var gossip []Autocrypt
+	for i := 0; i < maxSecurityLayers; i++ {
+		if err = s.ctx.Err(); err != nil {
+			return
+		}
+
+		var inner []byte
+		var layerGossip []Autocrypt
+		inner, layerGossip, err = unwrapPGPMIME(raw, provider, info)
+		if err != nil {
+			return
+		}
+
+		gossip = append(gossip, layerGossip...)
+
+		if inner == nil {
+			break
+		}
+
+		if err = s.enterMultipart(); err != nil {
+			return
+		}
+
+		if err = s.expand(len(inner)); err != nil {
+			return
+		}
+
+		raw = inner
+	}
+
+	email, err = s.parseNested(raw)
+	if err != nil {
+		return
+	}
+
+	if err = s.decodeInlinePGP(&email, provider, info); err != nil {
+		return
+	}
+
+	if info.Signed || info.Encrypted {
+		email.PGP = info
+	}
+
+	email.AutocryptGossip = gossip
+
+	return
+}
+
+// unwrapPGPMIME verifies or decrypts the outermost security layer of the message and returns the protected entity
+// with the header fields of the message, or nil when the message has no PGP/MIME layer, along with the
+// Autocrypt-Gossip headers of decrypted entities
+func unwrapPGPMIME(raw []byte, provider OpenPGPProvider, info *PGP) (inner []byte, gossip []Autocrypt, err error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contentType, params, err := parseContentType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case contentType == contentTypeMultipartSigned && strings.EqualFold(params["protocol"], "application/pgp-signature"):
+		parts, err := splitMultipart(body, params["boundary"])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(parts) != 2 {
+			return nil, nil, errInvalidPGPMIME
+		}
+
+		_, signature, err := readEntity(parts[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// signatures are computed over the canonical form of the entity, with CRLF line endings
+		info.Signed = true
+		info.Signatures = append(info.Signatures, verifyPGP(provider, canonicalLineEndings(parts[0]), signature)...)
+		inner = parts[0]
+	case contentType == contentTypeMultipartEncrypted && strings.EqualFold(params["protocol"], "application/pgp-encrypted"):
+		parts, err := splitMultipart(body, params["boundary"])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// the control part with the version is followed by the encrypted data
+		if len(parts) != 2 {
+			return nil, nil, errInvalidPGPMIME
+		}
+
+		_, message, err := readEntity(parts[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		plaintext, signatures, err := decryptPGP(provider, message)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		info.Encrypted = true
+		if len(signatures) > 0 {
+			info.Signed = true
+			info.Signatures = append(info.Signatures, signatures...)
+		}
+
+		gossip = parseEntityGossip(plaintext)
+
+		// the protected entity is in canonical form, with CRLF line endings
+		inner = bytes.Replace(plaintext, []byte("\r\n"), []byte("\n"), -1)
+	default:
+		return nil, nil, nil
+	}
+
+	inner, err = mergeEntityHeader(msg.Header, inner)
+
+	return inner, gossip, err
+}
+
+// decodeInlinePGP replaces the cleartext signed and the encrypted blocks of the text body by their text. Text
+// outside of the blocks, including encrypted blocks that can't be decrypted, is reported as Unsigned, unless the
+// message was signed as a whole by a PGP/MIME layer.
+func (s *parseState) decodeInlinePGP(email *Email, provider OpenPGPProvider, info *PGP) error {
+	if !strings.Contains(email.TextBody, "-----BEGIN PGP ") {
+		return nil
+	}
+
+	signedMIME := info.Signed
+	lines := strings.Split(email.TextBody, "\n")
+
+	var out []string
+	outside := false
+	for i := 0; i < len(lines); i++ {
+		switch strings.TrimRight(lines[i], " \t\r") {
+		case pgpSignedMessageBegin:
+			text, signed, signature, end := parseCleartextSignedBlock(lines, i)
+			if end < 0 {
+				out = append(out, lines[i])
+				outside = true
+				continue
+			}
+
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
+
+			info.Signed = true
+			info.Inline = true
+			info.Signatures = append(info.Signatures, verifyPGP(provider, signed, signature)...)
+			out = append(out, text...)
+			i = end
+		case pgpMessageBegin:
+			end := findArmorEnd(lines, i, pgpMessageEnd)
+			if end < 0 {
+				out = append(out, lines[i])
+				outside = true
+				continue
+			}
+
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
+
+			// e.g. quoted messages encrypted to someone else
+			plaintext, signatures, err := decryptPGP(provider, []byte(strings.Join(lines[i:end+1], "\n")))
+			if err != nil {
+				info.Encrypted = true
+				info.Inline = true
+				info.Err = err
+				out = append(out, lines[i:end+1]...)
+				outside = true
+				i = end
+				continue
+			}
+
+			if err := s.expand(len(plaintext)); err != nil {
+				return err
+			}
+
+			info.Encrypted = true
+			info.Inline = true
+			if len(signatures) > 0 {
+				info.Signed = true
+				info.Signatures = append(info.Signatures, signatures...)
+			}
+
+			text := strings.Replace(string(plaintext), "\r\n", "\n", -1)
+			out = append(out, strings.Split(strings.TrimSuffix(text, "\n"), "\n")...)
+			i = end
+		default:
+			out = append(out, lines[i])
+			if strings.TrimSpace(lines[i]) != "" {
+				outside = true
+			}
+		}
+	}
+
+	email.TextBody = strings.Join(out, "\n")
+	info.Unsigned = info.Inline && outside && !signedMIME
+
+	return nil
+}
+
+// parseCleartextSignedBlock parses the cleartext signed message starting at the line (see RFC 4880 section 7) into
+// its dash-unescaped text, the signed data and the armored signature. end is the index of the last line of the block,
+// -1 when the block is incomplete.
+func parseCleartextSignedBlock(lines []string, start int) (text []string, signed []byte, signature []byte, end int) {
+	i := start + 1
+
+	// armor headers, e.g. Hash
+	for i < len(lines) && strings.TrimRight(lines[i], "\r") != "" {
+		i++
+	}
+
+	i++
+
+	var canonical []string
+	for ; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if line == pgpSignatureBegin {
+			break
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			line = line[2:]
+		}
+
+		text = append(text, line)
+		canonical = append(canonical, strings.TrimRight(line, " \t"))
+	}
+
+	end = findArmorEnd(lines, i, pgpSignatureEnd)
+	if i >= len(lines) || end < 0 {
+		return nil, nil, nil, -1
+	}
+
+	signed = []byte(strings.Join(canonical, "\r\n"))
+	signature = []byte(strings.Join(lines[i:end+1], "\n"))
+
+	return text, signed, signature, end
+}
+
+// findArmorEnd returns the index of the end line of the armored block starting at the line, or -1
+func findArmorEnd(lines []string, start int, endLine string) int {
+	for i := start; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], " \t\r") == endLine {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func verifyPGP(provider OpenPGPProvider, data []byte, signature []byte) []PGPSignature {
+	if provider == nil {
+		return []PGPSignature{{Err: errPGPNoProvider}}
+	}
+
+	return provider.Verify(data, signature)
+}
+
+func decryptPGP(provider OpenPGPProvider, message []byte) ([]byte, []PGPSignature, error) {
+	if provider == nil {
+		return nil, nil, errPGPNoProvider
+	}
+
+	return provider.Decrypt(message)
+}
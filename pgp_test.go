@@ -0,0 +1,313 @@
+package parsemail
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testPGPProvider stands in for an OpenPGP implementation: messages are base64 encoded plaintexts and signatures are
+// the hex encoded SHA-256 of the data
+type testPGPProvider struct{}
+
+func (testPGPProvider) Decrypt(message []byte) ([]byte, []PGPSignature, error) {
+	plaintext, err := base64.StdEncoding.DecodeString(testArmorBody(message))
+
+	return plaintext, nil, err
+}
+
+func (testPGPProvider) Verify(data []byte, signature []byte) []PGPSignature {
+	sum := sha256.Sum256(data)
+	if testArmorBody(signature) != hex.EncodeToString(sum[:]) {
+		return []PGPSignature{{KeyID: 0x1234, Signer: "alice@example.com", Err: errors.New("bad signature")}}
+	}
+
+	return []PGPSignature{{KeyID: 0x1234, Signer: "alice@example.com"}}
+}
+
+// testArmorBody returns the data lines of an armored block
+func testArmorBody(armored []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(armored)), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			return strings.Join(lines[i+1:len(lines)-1], "")
+		}
+	}
+
+	return ""
+}
+
+func TestParsePGP(t *testing.T) {
+	var testData = map[int]struct {
+		message     string
+		subject     string
+		textBody    string
+		attachments int
+		signed      bool
+		encrypted   bool
+		inline      bool
+		unsigned    bool
+		verified    bool
+	}{
+		1: {
+			message:  pgpSignedExample,
+			subject:  "Signed",
+			textBody: "Hello signed",
+			signed:   true,
+			verified: true,
+		},
+		2: {
+			// signed, then encrypted, with protected headers
+			message:     pgpEncryptedExample,
+			subject:     "Protected subject",
+			textBody:    "Secret hello",
+			attachments: 1,
+			signed:      true,
+			encrypted:   true,
+			verified:    true,
+		},
+		3: {
+			message:   pgpInlineExample,
+			subject:   "Inline",
+			textBody:  "Before\nHello Bob,\n\n-- not a signature\nTrailing space   \nAlice\nAfter\n\nEncrypted\ninline text",
+			signed:    true,
+			encrypted: true,
+			inline:    true,
+			unsigned:  true,
+		},
+		4: {
+			message:  strings.Replace(pgpSignedExample, "Hello signed", "Hello tampered", 1),
+			subject:  "Signed",
+			textBody: "Hello tampered",
+			signed:   true,
+		},
+		5: {
+			// text before and after a valid cleartext signed block
+			message:  pgpInlineSignedExample,
+			subject:  "Inline signed",
+			textBody: "Unsigned before\nHello Bob,\n\n-- not a signature\nTrailing space   \nAlice\nUnsigned after",
+			signed:   true,
+			inline:   true,
+			unsigned: true,
+		},
+		6: {
+			message:  strings.Replace(strings.Replace(pgpInlineSignedExample, "Unsigned before\n", "", 1), "Unsigned after\n", "\n", 1),
+			subject:  "Inline signed",
+			textBody: "Hello Bob,\n\n-- not a signature\nTrailing space   \nAlice\n",
+			signed:   true,
+			inline:   true,
+			verified: true,
+		},
+	}
+
+	for index, td := range testData {
+		e, err := ParsePGP(strings.NewReader(td.message), testPGPProvider{})
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if e.Subject != td.subject {
+			t.Errorf("[Test Case %v] Wrong subject. Expected: %s, Got: %s", index, td.subject, e.Subject)
+		}
+
+		if e.TextBody != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.textBody, e.TextBody)
+		}
+
+		if len(e.Attachments) != td.attachments {
+			t.Errorf("[Test Case %v] Wrong number of attachments. Expected: %v, Got: %v", index, td.attachments, len(e.Attachments))
+		}
+
+		if e.PGP == nil {
+			t.Errorf("[Test Case %v] Missing PGP", index)
+			continue
+		}
+
+		if e.PGP.Signed != td.signed || e.PGP.Encrypted != td.encrypted || e.PGP.Inline != td.inline {
+			t.Errorf("[Test Case %v] Wrong layers. Expected: signed %v encrypted %v inline %v, Got: %+v", index, td.signed, td.encrypted, td.inline, e.PGP)
+		}
+
+		if e.PGP.Unsigned != td.unsigned {
+			t.Errorf("[Test Case %v] Wrong unsigned. Expected: %v, Got: %v", index, td.unsigned, e.PGP.Unsigned)
+		}
+
+		if e.PGP.Verified() != td.verified {
+			t.Errorf("[Test Case %v] Wrong verification. Expected: %v, Got: %+v", index, td.verified, e.PGP.Signatures)
+		}
+	}
+}
+
+func TestParsePGPWithoutProvider(t *testing.T) {
+	if _, err := ParsePGP(strings.NewReader(pgpEncryptedExample), nil); err != errPGPNoProvider {
+		t.Errorf("Wrong error. Expected: %v, Got: %v", errPGPNoProvider, err)
+	}
+
+	e, err := ParsePGP(strings.NewReader(pgpSignedExample), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.PGP == nil || e.PGP.Verified() || e.PGP.Signatures[0].Err != errPGPNoProvider {
+		t.Errorf("Expected unverified signature. Got: %+v", e.PGP)
+	}
+
+	// inline encrypted blocks that can't be decrypted are kept
+	e, err = ParsePGP(strings.NewReader(pgpInlineExample), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.PGP == nil || e.PGP.Err != errPGPNoProvider || !e.PGP.Encrypted || !e.PGP.Inline || !e.PGP.Unsigned || e.PGP.Verified() {
+		t.Errorf("Expected undecrypted inline block. Got: %+v", e.PGP)
+	}
+
+	if !strings.HasSuffix(e.TextBody, "After\n\n-----BEGIN PGP MESSAGE-----\n\nRW5jcnlwdGVkDQppbmxpbmUgdGV4dA0K\n-----END PGP MESSAGE-----") {
+		t.Errorf("Wrong text body. Got: %q", e.TextBody)
+	}
+}
+
+func TestParserParsePGP(t *testing.T) {
+	var testData = map[int]struct {
+		message string
+		limits  Limits
+		err     error
+	}{
+		1: {message: pgpEncryptedExample, limits: Limits{MaxDepth: 3}},
+		2: {message: pgpEncryptedExample, limits: Limits{MaxDepth: 2}, err: ErrDepthLimit},
+		3: {message: pgpEncryptedExample, limits: Limits{MaxTotalBytes: int64(len(pgpEncryptedExample) - 1)}, err: ErrTotalSizeLimit},
+		// the decrypted entity counts towards the size of the message
+		4: {message: pgpEncryptedExample, limits: Limits{MaxTotalBytes: int64(len(pgpEncryptedExample))}, err: ErrTotalSizeLimit},
+		5: {message: pgpEncryptedExample, limits: Limits{MaxTotalBytes: int64(3 * len(pgpEncryptedExample))}},
+	}
+
+	for index, td := range testData {
+		_, err := Parser{Limits: td.limits}.ParsePGP(strings.NewReader(td.message), testPGPProvider{})
+		if err != td.err {
+			t.Errorf("[Test Case %v] Wrong error. Expected: %v, Got: %v", index, td.err, err)
+		}
+	}
+
+	handlers := &ContentHandlers{}
+	handlers.Register("text/plain", func(part Part, email *Email) error {
+		email.TextBody = "Handled"
+		return nil
+	})
+
+	e, err := Parser{Handlers: handlers}.ParsePGP(strings.NewReader(pgpEncryptedExample), testPGPProvider{})
+	if err != nil {
+		t.Fatalf("ParsePGP failed: %v", err)
+	}
+
+	if e.TextBody != "Handled" {
+		t.Errorf("Wrong text body. Expected: %s, Got: %s", "Handled", e.TextBody)
+	}
+}
+
+var pgpSignedExample = `From: Alice <alice@example.com>
+To: bob@example.com
+Subject: Signed
+MIME-Version: 1.0
+Content-Type: multipart/signed; micalg=pgp-sha256; protocol="application/pgp-signature"; boundary="sig"
+
+This is an OpenPGP/MIME signed message (RFC 4880 and 3156)
+--sig
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+Hello signed
+--sig
+Content-Type: application/pgp-signature; name="signature.asc"
+Content-Description: OpenPGP digital signature
+Content-Disposition: attachment; filename="signature.asc"
+
+-----BEGIN PGP SIGNATURE-----
+
+3c122007ce29aefc326f37b724435cdf01699dcdd2a5f4f5f938cde7cb9e9546
+-----END PGP SIGNATURE-----
+--sig--
+`
+
+var pgpEncryptedExample = `From: Alice <alice@example.com>
+To: bob@example.com
+Subject: ...
+MIME-Version: 1.0
+Content-Type: multipart/encrypted; protocol="application/pgp-encrypted"; boundary="enc"
+
+This is an OpenPGP/MIME encrypted message (RFC 4880 and 3156)
+--enc
+Content-Type: application/pgp-encrypted
+Content-Description: PGP/MIME version identification
+
+Version: 1
+
+--enc
+Content-Type: application/octet-stream; name="encrypted.asc"
+Content-Description: OpenPGP encrypted message
+Content-Disposition: inline; filename="encrypted.asc"
+
+-----BEGIN PGP MESSAGE-----
+
+Q29udGVudC1UeXBlOiBtdWx0aXBhcnQvc2lnbmVkOyBtaWNhbGc9cGdwLXNoYTI1
+NjsgcHJvdG9jb2w9ImFwcGxpY2F0aW9uL3BncC1zaWduYXR1cmUiOyBib3VuZGFy
+eT0iaW5uZXJzaWciDQpTdWJqZWN0OiBQcm90ZWN0ZWQgc3ViamVjdA0KDQotLWlu
+bmVyc2lnDQpDb250ZW50LVR5cGU6IG11bHRpcGFydC9taXhlZDsgYm91bmRhcnk9
+Im1peGVkIg0KDQotLW1peGVkDQpDb250ZW50LVR5cGU6IHRleHQvcGxhaW4NCg0K
+U2VjcmV0IGhlbGxvDQotLW1peGVkDQpDb250ZW50LVR5cGU6IGFwcGxpY2F0aW9u
+L3BkZjsgbmFtZT0ibm90ZXMucGRmIg0KQ29udGVudC1EaXNwb3NpdGlvbjogYXR0
+YWNobWVudDsgZmlsZW5hbWU9Im5vdGVzLnBkZiINCkNvbnRlbnQtVHJhbnNmZXIt
+RW5jb2Rpbmc6IGJhc2U2NA0KDQpKVkJFUmkweExqUT0NCi0tbWl4ZWQtLQ0KLS1p
+bm5lcnNpZw0KQ29udGVudC1UeXBlOiBhcHBsaWNhdGlvbi9wZ3Atc2lnbmF0dXJl
+DQoNCi0tLS0tQkVHSU4gUEdQIFNJR05BVFVSRS0tLS0tDQoNCjJkMTJmZTE0ZTQ0
+MDcyOWRhMjAxZGE4NWU5NjExYWE3YzkyZTZmYjIyYTMzNmJkMDk1M2M5MWU5ZTY3
+NWY4YjINCi0tLS0tRU5EIFBHUCBTSUdOQVRVUkUtLS0tLQ0KLS1pbm5lcnNpZy0t
+DQo=
+-----END PGP MESSAGE-----
+
+--enc--
+`
+
+var pgpInlineExample = `From: alice@example.com
+Subject: Inline
+
+Before
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Hello Bob,
+
+- -- not a signature
+Trailing space   
+Alice
+-----BEGIN PGP SIGNATURE-----
+
+b9faee09403d74ac9e5cfed1b18f2ed4d1b9a869b766cfded4a7f05b9c6f0579
+-----END PGP SIGNATURE-----
+After
+
+-----BEGIN PGP MESSAGE-----
+
+RW5jcnlwdGVkDQppbmxpbmUgdGV4dA0K
+-----END PGP MESSAGE-----`
+
+var pgpInlineSignedExample = `From: alice@example.com
+Subject: Inline signed
+
+Unsigned before
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Hello Bob,
+
+- -- not a signature
+Trailing space   
+Alice
+-----BEGIN PGP SIGNATURE-----
+
+b9faee09403d74ac9e5cfed1b18f2ed4d1b9a869b766cfded4a7f05b9c6f0579
+-----END PGP SIGNATURE-----
+Unsigned after
+`
@@ -0,0 +1,200 @@
+package parsemail
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Reply with the new content of a message, separated from the quoted history and the signature
+type Reply struct {
+	// Text is the visible reply, without quotes and signature
+	Text string
+	// HTML is the html body cut before the quoted history, empty for plain text messages
+	HTML      string
+	Signature string
+	Quoted    string
+}
+
+// replyAttributionRe matches "On ... wrote:" style lines introducing the quoted message in many languages.
+// replyAttributionStart lists the languages whose attributions start with a fixed word, which allows recognizing
+// attributions wrapped over two lines.
+const replyAttributionStart = `on\b.+\bwrote:|` + // English
+	`am\b.+\bschrieb.*:|` + // German
+	`le\b.+\ba écrit\s*:|` + // French
+	`el\b.+\bescribió:|` + // Spanish
+	`il\b.+\bha scritto:|` + // Italian
+	`op\b.+\bschreef.*:|` + // Dutch
+	`em\b.+\bescreveu:|` + // Portuguese
+	`w dniu\b.+\bpisze:|` + // Polish
+	`den\b.+\bskrev.*:` // Danish, Norwegian, Swedish
+
+var replyAttributionRe = regexp.MustCompile(`(?i)^\s*(` + replyAttributionStart + `|` +
+	`.+\bнаписал\(?а?\)?:|` + // Russian
+	`.+\bkirjoitti:|` + // Finnish
+	`.+\bnapsal\(?a?\)?:|` + // Czech
+	`.+\bnapísal\(?a?\)?:|` + // Slovak
+	`.+\bwrote:` + // generic
+	`)\s*$`)
+var replyAttributionStartRe = regexp.MustCompile(`(?i)^\s*(` + replyAttributionStart + `)\s*$`)
+
+// replyOriginalMessageRe matches the separators Outlook and others put before the quoted or forwarded message
+var replyOriginalMessageRe = regexp.MustCompile(`(?i)^\s*(` +
+	`-{2,}\s*(original message|ursprüngliche nachricht|message d'origine|mensaje original|messaggio originale|` +
+	`oorspronkelijk bericht|mensagem original|původní zpráva|ursprungligt meddelande|oprindelig meddelelse|` +
+	`opprinnelig melding|alkuperäinen viesti|wiadomość oryginalna|forwarded message|weitergeleitete nachricht)\s*-{2,}|` +
+	`begin forwarded message:|` +
+	`_{20,}` +
+	`)\s*$`)
+
+// replyHeaderFromRe and replyHeaderDateRe match the header block Outlook puts above the quoted message
+var replyHeaderFromRe = regexp.MustCompile(`(?i)^\s*\*?(from|von|de|od|da|van|från|fra|lähettäjä|от)\s*:\*?\s`)
+var replyHeaderDateRe = regexp.MustCompile(`(?i)^\s*\*?(sent|date|gesendet|datum|envoyé|enviado|enviada|inviato|verzonden|skickat|sendt|odesláno|wysłano|data|отправлено|lähetetty)\s*:`)
+
+// replyMobileSignatureRe matches the signatures added by mobile and desktop mail apps
+var replyMobileSignatureRe = regexp.MustCompile(`(?i)^\s*(sent from my|sent from mail for|sent from outlook|get outlook for|von meinem .+ gesendet|envoyé de mon|enviado desde mi|inviato da|verzonden met|sent from yahoo mail)`)
+
+// htmlQuoteMarkers are classes and ids of the elements mail clients wrap quoted history in
+var htmlQuoteMarkers = []string{"gmail_quote", "yahoo_quoted", "moz-cite-prefix", "divrplyfwdmsg", "appendonsend",
+	"olk_src_body_section", "protonmail_quote", "zmail_extra"}
+
+// ExtractReply separates the new content of the email from quoted history and its signature. The text body is
+// used if present, otherwise the html body with quoted parts removed is converted to text.
+func (e Email) ExtractReply() Reply {
+	if strings.TrimSpace(e.TextBody) != "" {
+		return ExtractReplyText(e.TextBody)
+	}
+
+	html, quoted := cutHTMLQuote(e.HTMLBody)
+	r := ExtractReplyText(HTMLToText(html))
+	r.HTML = html
+	if quoted != "" {
+		r.Quoted = strings.TrimSpace(strings.TrimSpace(r.Quoted) + "\n\n" + HTMLToText(quoted))
+	}
+
+	return r
+}
+
+// ExtractReplyText separates the new content of a plain text message from the quoted history, introduced by
+// attribution lines ("On ... wrote:"), "-----Original Message-----" blocks, Outlook header blocks or quote markers
+// (">"), and from the signature, introduced by the "-- " delimiter or added by mobile mail apps.
+func ExtractReplyText(text string) Reply {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+
+	cut := len(lines)
+	for i := range lines {
+		if isQuoteStart(lines, i) {
+			cut = i
+			break
+		}
+	}
+
+	reply := lines[:cut]
+	r := Reply{Quoted: strings.TrimSpace(strings.Join(lines[cut:], "\n"))}
+
+	for i, line := range reply {
+		if line == "-- " || line == "--" || replyMobileSignatureRe.MatchString(line) {
+			r.Signature = strings.TrimSpace(strings.Join(reply[i:], "\n"))
+			reply = reply[:i]
+			break
+		}
+	}
+
+	r.Text = strings.TrimSpace(strings.Join(reply, "\n"))
+
+	return r
+}
+
+// isQuoteStart reports whether the quoted history starts at the line
+func isQuoteStart(lines []string, i int) bool {
+	line := lines[i]
+
+	// attribution lines are often wrapped by the client
+	if i+1 < len(lines) && strings.TrimSpace(line) != "" && replyAttributionStartRe.MatchString(line+" "+lines[i+1]) &&
+		!replyAttributionRe.MatchString(line) {
+		return true
+	}
+
+	if replyAttributionRe.MatchString(line) || replyOriginalMessageRe.MatchString(line) {
+		return true
+	}
+
+	if replyHeaderFromRe.MatchString(line) {
+		for j := i + 1; j < len(lines) && j <= i+4; j++ {
+			if replyHeaderDateRe.MatchString(lines[j]) {
+				return true
+			}
+		}
+	}
+
+	if strings.HasPrefix(line, ">") {
+		// quote markers only start the history if nothing but quoted or empty lines follow, keeping interleaved replies
+		for _, l := range lines[i+1:] {
+			if t := strings.TrimSpace(l); t != "" && !strings.HasPrefix(t, ">") {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// cutHTMLQuote splits the html before the first element marking quoted history, closing the elements left open
+func cutHTMLQuote(html string) (reply, quoted string) {
+	var b strings.Builder
+	var open []string
+
+	tokens := tokenizeHTML(html)
+	for i, t := range tokens {
+		if (t.typ == htmlStartTagToken || t.typ == htmlSelfClosingTagToken) && isHTMLQuote(t) {
+			for j := len(open) - 1; j >= 0; j-- {
+				b.WriteString("</" + open[j] + ">")
+			}
+
+			var q strings.Builder
+			for _, qt := range tokens[i:] {
+				q.WriteString(qt.raw)
+			}
+
+			return b.String(), q.String()
+		}
+
+		switch t.typ {
+		case htmlStartTagToken:
+			if !isVoidElement(t.name) {
+				open = append(open, t.name)
+			}
+		case htmlEndTagToken:
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j] == t.name {
+					open = open[:j]
+					break
+				}
+			}
+		}
+
+		b.WriteString(t.raw)
+	}
+
+	return html, ""
+}
+
+func isHTMLQuote(t htmlToken) bool {
+	if t.name == "blockquote" {
+		if typ, _ := t.attr("type"); strings.EqualFold(typ, "cite") {
+			return true
+		}
+	}
+
+	class, _ := t.attr("class")
+	id, _ := t.attr("id")
+	markers := strings.ToLower(class + " " + id)
+	for _, m := range htmlQuoteMarkers {
+		if strings.Contains(markers, m) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractReplyText(t *testing.T) {
+	var testData = map[int]struct {
+		text      string
+		reply     string
+		signature string
+		quoted    string
+	}{
+		1: {
+			text:   "Sounds good.\r\n\r\nOn Mon, 4 Mar 2019 at 10:00, John Doe <john@example.com> wrote:\r\n> Shall we meet?\r\n",
+			reply:  "Sounds good.",
+			quoted: "On Mon, 4 Mar 2019 at 10:00, John Doe <john@example.com> wrote:\n> Shall we meet?",
+		},
+		2: {
+			text:   "Ja, gerne.\n\nAm 04.03.2019 um 10:00 schrieb John Doe <john@example.com>:\n> Treffen wir uns?",
+			reply:  "Ja, gerne.",
+			quoted: "Am 04.03.2019 um 10:00 schrieb John Doe <john@example.com>:\n> Treffen wir uns?",
+		},
+		3: {
+			text:   "D'accord.\n\nLe lun. 4 mars 2019 à 10:00, John Doe <john@example.com> a écrit :\n> On se voit ?",
+			reply:  "D'accord.",
+			quoted: "Le lun. 4 mars 2019 à 10:00, John Doe <john@example.com> a écrit :\n> On se voit ?",
+		},
+		4: {
+			text:   "Sure.\n\nOn Mon, 4 Mar 2019 at 10:00, John Doe <\njohn@example.com> wrote:\n> Shall we meet?",
+			reply:  "Sure.",
+			quoted: "On Mon, 4 Mar 2019 at 10:00, John Doe <\njohn@example.com> wrote:\n> Shall we meet?",
+		},
+		5: {
+			text:   "Approved.\n\n-----Original Message-----\nFrom: John Doe\nSent: Monday, March 4, 2019 10:00 AM\nSubject: Budget\n\nPlease approve.",
+			reply:  "Approved.",
+			quoted: "-----Original Message-----\nFrom: John Doe\nSent: Monday, March 4, 2019 10:00 AM\nSubject: Budget\n\nPlease approve.",
+		},
+		6: {
+			text:   "Approved.\n\nFrom: John Doe <john@example.com>\nSent: Monday, March 4, 2019 10:00 AM\nTo: Jane\nSubject: Budget\n\nPlease approve.",
+			reply:  "Approved.",
+			quoted: "From: John Doe <john@example.com>\nSent: Monday, March 4, 2019 10:00 AM\nTo: Jane\nSubject: Budget\n\nPlease approve.",
+		},
+		7: {
+			text:      "Thanks!\n\n-- \nJane Doe\nACME Inc.\n\n> Here you go.",
+			reply:     "Thanks!",
+			signature: "-- \nJane Doe\nACME Inc.",
+			quoted:    "> Here you go.",
+		},
+		8: {
+			text:      "Will do.\n\nSent from my iPhone",
+			reply:     "Will do.",
+			signature: "Sent from my iPhone",
+		},
+		9: {
+			text:  "> First question?\nFirst answer.\n> Second question?\nSecond answer.",
+			reply: "> First question?\nFirst answer.\n> Second question?\nSecond answer.",
+		},
+		10: {
+			text:  "From: the start of the week, I will be away.",
+			reply: "From: the start of the week, I will be away.",
+		},
+	}
+
+	for index, td := range testData {
+		r := ExtractReplyText(td.text)
+		if r.Text != td.reply {
+			t.Errorf("[Test Case %v] Wrong reply. Expected: '%s', Got: '%s'", index, td.reply, r.Text)
+		}
+
+		if r.Signature != td.signature {
+			t.Errorf("[Test Case %v] Wrong signature. Expected: '%s', Got: '%s'", index, td.signature, r.Signature)
+		}
+
+		if r.Quoted != td.quoted {
+			t.Errorf("[Test Case %v] Wrong quoted. Expected: '%s', Got: '%s'", index, td.quoted, r.Quoted)
+		}
+	}
+}
+
+func TestExtractReplyHTML(t *testing.T) {
+	var testData = map[int]struct {
+		html   string
+		reply  string
+		text   string
+		quoted string
+	}{
+		1: {
+			html:   `<div dir="ltr">Sounds <b>good</b>.</div><br><div class="gmail_quote"><div class="gmail_attr">On Mon, John wrote:</div><blockquote>Shall we meet?</blockquote></div>`,
+			reply:  `<div dir="ltr">Sounds <b>good</b>.</div><br>`,
+			text:   "Sounds good.",
+			quoted: "On Mon, John wrote:\n\n> Shall we meet?",
+		},
+		2: {
+			html:  `<html><body><p>Yes.</p><blockquote type="cite"><p>Shall we meet?</p></blockquote></body></html>`,
+			reply: `<html><body><p>Yes.</p></body></html>`,
+			text:  "Yes.",
+		},
+		3: {
+			html:  `<html><body><div>Approved.</div><div id="divRplyFwdMsg"><b>From:</b> John</div><div>Please approve.</div></body></html>`,
+			reply: `<html><body><div>Approved.</div></body></html>`,
+			text:  "Approved.",
+		},
+		4: {
+			html:  `<p>No quotes here.</p>`,
+			reply: `<p>No quotes here.</p>`,
+			text:  "No quotes here.",
+		},
+	}
+
+	for index, td := range testData {
+		r := Email{HTMLBody: td.html}.ExtractReply()
+		if r.HTML != td.reply {
+			t.Errorf("[Test Case %v] Wrong html. Expected: '%s', Got: '%s'", index, td.reply, r.HTML)
+		}
+
+		if r.Text != td.text {
+			t.Errorf("[Test Case %v] Wrong text. Expected: '%s', Got: '%s'", index, td.text, r.Text)
+		}
+
+		if td.quoted != "" && r.Quoted != td.quoted {
+			t.Errorf("[Test Case %v] Wrong quoted. Expected: '%s', Got: '%s'", index, td.quoted, r.Quoted)
+		}
+
+		if td.html != td.reply && r.Quoted == "" {
+			t.Errorf("[Test Case %v] Expected quoted history", index)
+		}
+	}
+}
+
+func TestExtractReplyPrefersText(t *testing.T) {
+	r := Email{TextBody: "Text reply\n> quote", HTMLBody: "<p>HTML reply</p>"}.ExtractReply()
+	if r.Text != "Text reply" || r.HTML != "" || !strings.HasPrefix(r.Quoted, ">") {
+		t.Errorf("Wrong reply from text body: %+v", r)
+	}
+}
@@ -0,0 +1,325 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+const (
+	rtfCompressed   = 0x75465A4C // "LZFu"
+	rtfUncompressed = 0x414C454D // "MELA"
+	// rtfMaxExpansion is the most compressed RTF expands by, 8 references of 2 bytes to 17 bytes each per control byte
+	rtfMaxExpansion = 8
+)
+
+// rtfDictionary is the initial content of the LZFu dictionary
+const rtfDictionary = `{\rtf1\ansi\mac\deff0\deftab720{\fonttbl;}{\f0\fnil \froman \fswiss \fmodern \fscript \fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\colortbl\red0\green0\blue0` + "\r\n" + `\par \pard\plain\f0\fs20\b\i\u\tab\tx`
+
+var errInvalidCompressedRTF = errors.New("invalid compressed RTF")
+
+// rtfDestinations are the groups whose content is not text
+var rtfDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true, "object": true,
+	"header": true, "footer": true, "headerl": true, "headerr": true, "footerl": true, "footerr": true,
+	"listtable": true, "listoverridetable": true, "rsidtbl": true, "generator": true, "xmlnstbl": true,
+	"themedata": true, "colorschememapping": true, "latentstyles": true, "datastore": true, "filetbl": true,
+	"revtbl": true, "pgdsctbl": true, "operator": true, "author": true, "title": true,
+}
+
+// rtfSpecialCharacters are the control words for characters
+var rtfSpecialCharacters = map[string]string{
+	"tab": "\t", "emdash": "—", "endash": "–", "emspace": " ", "enspace": " ",
+	"bullet": "•", "lquote": "‘", "rquote": "’", "ldblquote": "“", "rdblquote": "”",
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F of the Windows-1252 code page, the others match Latin-1
+var windows1252 = []rune("€�‚ƒ„…†‡ˆ‰Š‹Œ�Ž�" +
+	"�‘’“”•–—˜™š›œ�žŸ")
+
+// DecompressRTF decodes compressed RTF (MS-OXRTFCP) as found in the PR_RTF_COMPRESSED property of TNEF and Outlook
+// .msg files
+func DecompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, errInvalidCompressedRTF
+	}
+
+	compressedSize := int(binary.LittleEndian.Uint32(data))
+	rawSize := int(binary.LittleEndian.Uint32(data[4:]))
+	compression := binary.LittleEndian.Uint32(data[8:])
+	crc := binary.LittleEndian.Uint32(data[12:])
+
+	if compressedSize < 12 || compressedSize-12 > len(data)-16 {
+		return nil, errInvalidCompressedRTF
+	}
+
+	content := data[16 : 16+compressedSize-12]
+
+	switch compression {
+	case rtfUncompressed:
+		if rawSize > len(content) {
+			return nil, errInvalidCompressedRTF
+		}
+
+		return content[:rawSize], nil
+	case rtfCompressed:
+	default:
+		return nil, errInvalidCompressedRTF
+	}
+
+	if ^crc32.Update(0xFFFFFFFF, crc32.IEEETable, content) != crc {
+		return nil, errInvalidCompressedRTF
+	}
+
+	// the content can't expand to more, which bounds the output preallocated
+	if rawSize > rtfMaxExpansion*len(content) {
+		return nil, errInvalidCompressedRTF
+	}
+
+	var dictionary [4096]byte
+	copy(dictionary[:], rtfDictionary)
+	write := len(rtfDictionary)
+
+	out := make([]byte, 0, rawSize)
+	for i := 0; i < len(content); {
+		control := content[i]
+		i++
+
+		for bit := uint(0); bit < 8 && i < len(content); bit++ {
+			if len(out) == rawSize {
+				return out, nil
+			}
+
+			if control&(1<<bit) == 0 {
+				out = append(out, content[i])
+				dictionary[write] = content[i]
+				write = (write + 1) % len(dictionary)
+				i++
+				continue
+			}
+
+			if i+1 >= len(content) {
+				return nil, errInvalidCompressedRTF
+			}
+
+			reference := int(content[i])<<8 | int(content[i+1])
+			i += 2
+
+			offset := reference >> 4
+			if offset == write {
+				return out, nil
+			}
+
+			for k := 0; k < reference&0xF+2 && len(out) < rawSize; k++ {
+				b := dictionary[(offset+k)%len(dictionary)]
+				out = append(out, b)
+				dictionary[write] = b
+				write = (write + 1) % len(dictionary)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// DecapsulateRTF extracts the html body (\fromhtml1, see MS-OXRTFEX) or the plain text body (\fromtext) of RTF as
+// generated by Outlook. The text of other RTF documents is returned as plain text. Characters of code pages other
+// than Windows-1252 are only supported when encoded as unicode (\u).
+func DecapsulateRTF(rtf []byte) (html string, text string) {
+	header := rtf
+	if len(header) > 1024 {
+		header = header[:1024]
+	}
+
+	fromHTML := bytes.Contains(header, []byte(`\fromhtml1`))
+
+	type rtfGroup struct {
+		skip    bool
+		htmlrtf bool
+		htmltag bool
+		uc      int
+	}
+
+	var out strings.Builder
+	var stack []rtfGroup
+
+	group := rtfGroup{uc: 1}
+	codepage := 1252
+	skipChars := 0
+	groupStart := false
+
+	emit := func(s string) {
+		if group.skip || (group.htmlrtf && !group.htmltag) {
+			return
+		}
+
+		for _, r := range s {
+			if skipChars > 0 {
+				skipChars--
+				continue
+			}
+
+			out.WriteRune(r)
+		}
+	}
+
+	for i := 0; i < len(rtf); i++ {
+		c := rtf[i]
+		switch c {
+		case '{':
+			stack = append(stack, group)
+			groupStart = true
+
+			// ignorable destinations, of which only html tags are part of the encapsulated html
+			if strings.HasPrefix(string(rtf[i+1:minInt(i+12, len(rtf))]), `\*\htmltag`) {
+				group.htmltag = true
+				i += 2
+			} else if i+2 < len(rtf) && rtf[i+1] == '\\' && rtf[i+2] == '*' {
+				group.skip = true
+				i += 2
+			}
+
+			continue
+		case '}':
+			if len(stack) > 0 {
+				group = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case '\\':
+			if i+1 >= len(rtf) {
+				break
+			}
+
+			next := rtf[i+1]
+			switch {
+			case isASCIILetter(next):
+				j := i + 1
+				for j < len(rtf) && isASCIILetter(rtf[j]) {
+					j++
+				}
+
+				word := string(rtf[i+1 : j])
+				k := j
+				if k < len(rtf) && rtf[k] == '-' {
+					k++
+				}
+
+				for k < len(rtf) && rtf[k] >= '0' && rtf[k] <= '9' {
+					k++
+				}
+
+				param, err := strconv.Atoi(string(rtf[j:k]))
+				hasParam := err == nil
+				if k < len(rtf) && rtf[k] == ' ' {
+					k++
+				}
+
+				i = k - 1
+
+				if groupStart && rtfDestinations[word] {
+					group.skip = true
+				}
+
+				groupStart = false
+
+				switch {
+				case word == "htmlrtf":
+					group.htmlrtf = !hasParam || param != 0
+				case word == "par" || word == "line":
+					if fromHTML {
+						emit("\r\n")
+					} else {
+						emit("\n")
+					}
+				case word == "u" && hasParam:
+					if param < 0 {
+						param += 65536
+					}
+
+					emit(string(rune(param)))
+					if !group.skip && !(group.htmlrtf && !group.htmltag) {
+						skipChars = group.uc
+					}
+				case word == "uc" && hasParam:
+					group.uc = param
+				case word == "ansicpg" && hasParam:
+					codepage = param
+				case rtfSpecialCharacters[word] != "":
+					emit(rtfSpecialCharacters[word])
+				}
+
+				continue
+			case next == '\'' && i+3 < len(rtf):
+				if b, err := strconv.ParseUint(string(rtf[i+2:i+4]), 16, 8); err == nil {
+					emit(string(decodeCodepageByte(byte(b), codepage)))
+				}
+
+				i += 3
+			case next == '~':
+				emit(" ")
+				i++
+			case next == '_':
+				emit("-")
+				i++
+			case next == '\r' || next == '\n':
+				if fromHTML {
+					emit("\r\n")
+				} else {
+					emit("\n")
+				}
+
+				i++
+			case next == '{' || next == '}' || next == '\\':
+				emit(string(next))
+				i++
+			default:
+				// other control symbols, e.g. optional hyphens
+				i++
+			}
+		case '\r', '\n':
+		default:
+			emit(string(c))
+		}
+
+		groupStart = false
+	}
+
+	if fromHTML {
+		return out.String(), ""
+	}
+
+	return "", strings.TrimSpace(out.String())
+}
+
+// decodeRTFBody decompresses compressed RTF and returns the html or plain text body it contains
+func decodeRTFBody(compressed []byte) (html string, text string) {
+	if len(compressed) == 0 {
+		return "", ""
+	}
+
+	rtf, err := DecompressRTF(compressed)
+	if err != nil {
+		return "", ""
+	}
+
+	return DecapsulateRTF(rtf)
+}
+
+func decodeCodepageByte(b byte, codepage int) rune {
+	if codepage == 1252 && b >= 0x80 && b <= 0x9F {
+		return windows1252[b-0x80]
+	}
+
+	return rune(b)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,147 @@
+package parsemail
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func TestDecompressRTF(t *testing.T) {
+	var testData = map[int]struct {
+		data     []byte
+		expected string
+		err      bool
+	}{
+		1: {
+			// example from MS-OXRTFCP
+			data: []byte("\x2d\x00\x00\x00\x2b\x00\x00\x00\x4c\x5a\x46\x75\xf1\xc5\xc7\xa7\x03\x00\x0a\x00\x72\x63\x70\x67" +
+				"\x31\x32\x35\x42\x32\x0a\xf3\x20\x68\x65\x6c\x09\x00\x20\x62\x77\x05\xb0\x6c\x64\x7d\x0a\x80\x0f\xa0"),
+			expected: "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n",
+		},
+		2: {
+			data:     append([]byte("\x10\x00\x00\x00\x04\x00\x00\x00MELA\x00\x00\x00\x00"), "{\\rtf}"...),
+			expected: "{\\rt",
+		},
+		3: {
+			data:     compressRTF("{\\rtf1 literal only}"),
+			expected: "{\\rtf1 literal only}",
+		},
+		4: {
+			// wrong CRC
+			data: []byte("\x2d\x00\x00\x00\x2b\x00\x00\x00\x4c\x5a\x46\x75\x00\xc5\xc7\xa7\x03\x00\x0a\x00\x72\x63\x70\x67" +
+				"\x31\x32\x35\x42\x32\x0a\xf3\x20\x68\x65\x6c\x09\x00\x20\x62\x77\x05\xb0\x6c\x64\x7d\x0a\x80\x0f\xa0"),
+			err: true,
+		},
+		5: {
+			data: []byte("\x10\x00\x00\x00\x04\x00\x00\x00ABCD\x00\x00\x00\x00{\\rt"),
+			err:  true,
+		},
+		6: {
+			data: []byte("LZFu"),
+			err:  true,
+		},
+		7: {
+			// raw size the content can't expand to
+			data: withRTFRawSize(compressRTF("{\\rtf1 literal only}"), 0xFFFFFFFF),
+			err:  true,
+		},
+		8: {
+			// output beyond the raw size
+			data:     withRTFRawSize(compressRTF("{\\rtf1 literal only}"), 6),
+			expected: "{\\rtf1",
+		},
+	}
+
+	for index, td := range testData {
+		rtf, err := DecompressRTF(td.data)
+		if td.err {
+			if err == nil {
+				t.Errorf("[Test Case %v] Expected error", index)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if string(rtf) != td.expected {
+			t.Errorf("[Test Case %v] Wrong RTF. Expected: %q, Got: %q", index, td.expected, rtf)
+		}
+	}
+}
+
+func TestDecapsulateRTF(t *testing.T) {
+	var testData = map[int]struct {
+		rtf  string
+		html string
+		text string
+	}{
+		1: {
+			rtf: `{\rtf1\ansi\ansicpg1252\fromhtml1 \deff0{\fonttbl{\f0\fswiss Arial;}}` + "\r\n" +
+				`{\*\htmltag19 <html>}{\*\htmltag34 <head>}{\*\htmltag41 <style>\par p \{ margin: 0 \}\par </style>}` +
+				`\htmlrtf {\htmlrtf0 {\*\htmltag64 <p>}Caf\'e9 \'80 5\htmlrtf\par\htmlrtf0{\*\htmltag72 </p>}}` +
+				`\htmlrtf0 {\*\htmltag64 <p>}\u26085?\u26412?{\*\htmltag72 </p>}{\*\htmltag27 </html>}}`,
+			html: "<html><head><style>\r\np { margin: 0 }\r\n</style><p>Café € 5</p><p>日本</p></html>",
+		},
+		2: {
+			rtf:  `{\rtf1\ansi\fromtext \deff0{\fonttbl{\f0\fmodern Courier;}}{\*\generator Microsoft Exchange Server;}\par Hello\tab world,\par \par -- \par John}`,
+			text: "Hello\tworld,\n\n-- \nJohn",
+		},
+		3: {
+			rtf:  `{\rtf1\ansi\deff0{\fonttbl{\f0 Arial;}}{\info{\title Note}}\pard\b Bold\b0  and \{braces\}\par\ldblquote quoted\rdblquote}`,
+			text: "Bold and {braces}\n“quoted”",
+		},
+	}
+
+	for index, td := range testData {
+		html, text := DecapsulateRTF([]byte(td.rtf))
+		if html != td.html {
+			t.Errorf("[Test Case %v] Wrong html. Expected: %q, Got: %q", index, td.html, html)
+		}
+
+		if text != td.text {
+			t.Errorf("[Test Case %v] Wrong text. Expected: %q, Got: %q", index, td.text, text)
+		}
+	}
+}
+
+// compressRTF encodes the RTF as compressed RTF made of literals only
+// withRTFRawSize replaces the raw size in the header of compressed RTF
+func withRTFRawSize(data []byte, size uint32) []byte {
+	binary.LittleEndian.PutUint32(data[4:], size)
+	return data
+}
+
+func compressRTF(rtf string) []byte {
+	var content []byte
+	for i := 0; i < len(rtf); i += 8 {
+		end := i + 8
+		if end > len(rtf) {
+			end = len(rtf)
+		}
+
+		content = append(content, 0)
+		content = append(content, rtf[i:end]...)
+	}
+
+	// end of stream reference to the write position
+	write := (207 + len(rtf)) % 4096
+	if len(rtf)%8 == 0 {
+		content = append(content, 0x01)
+	} else {
+		content[len(content)-(len(rtf)%8)-1] |= 1 << uint(len(rtf)%8)
+	}
+
+	content = append(content, byte(write>>4), byte(write<<4))
+
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header, uint32(len(content)+12))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(rtf)))
+	binary.LittleEndian.PutUint32(header[8:], rtfCompressed)
+	binary.LittleEndian.PutUint32(header[12:], ^crc32.Update(0xFFFFFFFF, crc32.IEEETable, content))
+
+	return append(header, content...)
+}
@@ -0,0 +1,464 @@
+package parsemail
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// SanitizePolicy configures which parts of a HTML body survive sanitization
+type SanitizePolicy struct {
+	// AllowedTags are kept, other tags are removed while their content is kept. Scripts, styles, frames, embedded
+	// objects and form controls are always removed with their content.
+	AllowedTags []string
+	// AllowedAttributes maps tag names to their allowed attributes, "*" applies to all tags. Event handlers are
+	// always removed.
+	AllowedAttributes map[string][]string
+	// AllowedSchemes of URLs in links and resources. Relative URLs are always allowed.
+	AllowedSchemes []string
+	// ExternalResources is called with the URL of every remote resource (images, backgrounds, CSS urls) and returns
+	// the URL to use instead, or "" to block the resource. If nil, remote resources are blocked.
+	ExternalResources func(url string) string
+}
+
+// SanitizeReport lists what was removed from the HTML during sanitization
+type SanitizeReport struct {
+	RemovedTags       []string
+	RemovedAttributes []string
+	BlockedURLs       []string
+	RewrittenURLs     []string
+	RemovedCSS        []string
+}
+
+// htmlDangerousElements are removed together with their content
+var htmlDangerousElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true, "object": true, "embed": true,
+	"applet": true, "noscript": true, "template": true, "head": true, "title": true, "select": true,
+	"textarea": true, "button": true, "input": true, "svg": true, "math": true, "base": true, "link": true,
+	"meta": true,
+}
+
+// htmlURLAttributes hold URLs of links; htmlResourceAttributes hold URLs of resources loaded when displayed
+var htmlURLAttributes = map[string]bool{"href": true, "cite": true, "action": true, "longdesc": true}
+var htmlResourceAttributes = map[string]bool{"src": true, "background": true, "poster": true, "lowsrc": true, "dynsrc": true}
+
+var cssURLRe = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")]*)['"]?\s*\)`)
+var cssDangerousRe = regexp.MustCompile(`(?i)(expression\s*\(|javascript:|vbscript:|behavior\s*:|-moz-binding|@import|position\s*:\s*fixed)`)
+var urlSchemeRe = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.\-]*):`)
+
+// cssURLFunctions take URLs as strings, e.g. image-set("a.png" 1x)
+var cssURLFunctions = map[string]bool{
+	"image-set": true, "-webkit-image-set": true, "image": true, "-webkit-image": true, "cross-fade": true,
+	"-webkit-cross-fade": true, "src": true,
+}
+
+// DefaultSanitizePolicy returns a policy keeping the formatting elements commonly used in emails, allowing
+// http(s), mailto, tel and cid URLs and blocking remote resources
+func DefaultSanitizePolicy() SanitizePolicy {
+	return SanitizePolicy{
+		AllowedTags: []string{
+			"a", "abbr", "acronym", "address", "b", "bdi", "bdo", "big", "blockquote", "br", "caption", "center",
+			"cite", "code", "col", "colgroup", "dd", "del", "dfn", "div", "dl", "dt", "em", "figcaption", "figure",
+			"font", "h1", "h2", "h3", "h4", "h5", "h6", "hr", "i", "img", "ins", "kbd", "li", "mark", "ol", "p",
+			"pre", "q", "s", "samp", "small", "span", "strike", "strong", "sub", "sup", "table", "tbody", "td",
+			"tfoot", "th", "thead", "tr", "tt", "u", "ul", "var",
+		},
+		AllowedAttributes: map[string][]string{
+			"*": {"align", "bgcolor", "border", "class", "color", "dir", "height", "lang", "style", "title",
+				"valign", "width"},
+			"a":          {"href", "name"},
+			"img":        {"src", "alt", "hspace", "vspace"},
+			"font":       {"face", "size"},
+			"table":      {"background", "cellpadding", "cellspacing", "summary"},
+			"td":         {"background", "colspan", "rowspan", "nowrap", "headers", "scope"},
+			"th":         {"background", "colspan", "rowspan", "nowrap", "headers", "scope"},
+			"col":        {"span"},
+			"colgroup":   {"span"},
+			"ol":         {"start", "type", "reversed"},
+			"ul":         {"type"},
+			"li":         {"value", "type"},
+			"blockquote": {"cite", "type"},
+			"q":          {"cite"},
+			"del":        {"cite", "datetime"},
+			"ins":        {"cite", "datetime"},
+		},
+		AllowedSchemes: []string{"http", "https", "mailto", "tel", "cid"},
+	}
+}
+
+// SanitizedHTML returns the html body of the email sanitized according to the policy, see SanitizeHTML
+func (e Email) SanitizedHTML(policy SanitizePolicy) (string, SanitizeReport) {
+	return SanitizeHTML(e.HTMLBody, policy)
+}
+
+// SanitizeHTML makes HTML safe for display by removing scripts, event handlers, forms, frames, dangerous CSS and
+// everything not in the allowlists of the policy, and by blocking or rewriting remote resources
+func SanitizeHTML(body string, policy SanitizePolicy) (string, SanitizeReport) {
+	s := newSanitizer(policy)
+
+	var b strings.Builder
+	var dropped []string
+
+	for _, t := range tokenizeHTML(body) {
+		if len(dropped) > 0 {
+			switch {
+			case t.typ == htmlStartTagToken && t.name == dropped[len(dropped)-1]:
+				dropped = append(dropped, t.name)
+			case t.typ == htmlEndTagToken && t.name == dropped[len(dropped)-1]:
+				dropped = dropped[:len(dropped)-1]
+			}
+
+			continue
+		}
+
+		switch t.typ {
+		case htmlTextToken:
+			b.WriteString(html.EscapeString(t.text()))
+		case htmlStartTagToken, htmlSelfClosingTagToken:
+			if htmlDangerousElements[t.name] {
+				s.report.RemovedTags = appendUnique(s.report.RemovedTags, t.name)
+				if t.typ == htmlStartTagToken && !isVoidElement(t.name) {
+					dropped = append(dropped, t.name)
+				}
+
+				continue
+			}
+
+			if !s.tags[t.name] {
+				s.report.RemovedTags = appendUnique(s.report.RemovedTags, t.name)
+				continue
+			}
+
+			t.attrs = s.sanitizeAttributes(t)
+			b.WriteString(renderHTMLTag(t))
+		case htmlEndTagToken:
+			if s.tags[t.name] && !isVoidElement(t.name) {
+				b.WriteString("</" + t.name + ">")
+			}
+		}
+	}
+
+	return b.String(), s.report
+}
+
+type sanitizer struct {
+	policy  SanitizePolicy
+	tags    map[string]bool
+	schemes map[string]bool
+	report  SanitizeReport
+}
+
+func newSanitizer(policy SanitizePolicy) *sanitizer {
+	s := &sanitizer{policy: policy, tags: map[string]bool{}, schemes: map[string]bool{}}
+	for _, t := range policy.AllowedTags {
+		s.tags[strings.ToLower(t)] = true
+	}
+
+	for _, scheme := range policy.AllowedSchemes {
+		s.schemes[strings.ToLower(scheme)] = true
+	}
+
+	return s
+}
+
+func (s *sanitizer) attributeAllowed(tag, attr string) bool {
+	for _, key := range []string{"*", tag} {
+		for _, a := range s.policy.AllowedAttributes[key] {
+			if strings.EqualFold(a, attr) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *sanitizer) sanitizeAttributes(t htmlToken) (attrs []htmlAttribute) {
+	for _, a := range t.attrs {
+		if strings.HasPrefix(a.name, "on") || !s.attributeAllowed(t.name, a.name) {
+			s.report.RemovedAttributes = appendUnique(s.report.RemovedAttributes, t.name+"."+a.name)
+			continue
+		}
+
+		switch {
+		case htmlURLAttributes[a.name]:
+			if !s.urlAllowed(a.value, t.name == "img") {
+				s.report.BlockedURLs = appendUnique(s.report.BlockedURLs, a.value)
+				continue
+			}
+		case htmlResourceAttributes[a.name]:
+			v, ok := s.resourceURL(a.value, t.name == "img")
+			if !ok {
+				continue
+			}
+
+			a.value = v
+		case a.name == "style":
+			a.value = s.sanitizeCSS(a.value)
+			if a.value == "" {
+				continue
+			}
+		}
+
+		attrs = append(attrs, a)
+	}
+
+	return
+}
+
+// urlAllowed checks the scheme of the URL against the policy. Data URLs are only allowed for images.
+func (s *sanitizer) urlAllowed(u string, image bool) bool {
+	u = stripControl(u)
+	m := urlSchemeRe.FindStringSubmatch(u)
+	if m == nil {
+		return true
+	}
+
+	scheme := strings.ToLower(m[1])
+	if scheme == "data" {
+		return image && strings.HasPrefix(strings.ToLower(u), "data:image/") && !strings.HasPrefix(strings.ToLower(u), "data:image/svg")
+	}
+
+	return s.schemes[scheme]
+}
+
+// resourceURL returns the URL under which a resource may be loaded, passing remote resources through the policy
+func (s *sanitizer) resourceURL(u string, image bool) (string, bool) {
+	// browsers read backslashes as slashes
+	trimmed := strings.Replace(stripControl(u), "\\", "/", -1)
+
+	if !s.urlAllowed(trimmed, image) {
+		s.report.BlockedURLs = appendUnique(s.report.BlockedURLs, u)
+		return "", false
+	}
+
+	if !isRemoteURL(trimmed) {
+		return u, true
+	}
+
+	if s.policy.ExternalResources == nil {
+		s.report.BlockedURLs = appendUnique(s.report.BlockedURLs, u)
+		return "", false
+	}
+
+	rewritten := s.policy.ExternalResources(trimmed)
+	if rewritten == "" {
+		s.report.BlockedURLs = appendUnique(s.report.BlockedURLs, u)
+		return "", false
+	}
+
+	if rewritten != trimmed {
+		s.report.RewrittenURLs = appendUnique(s.report.RewrittenURLs, u)
+	}
+
+	return rewritten, true
+}
+
+// isRemoteURL reports whether the URL loads a resource from a host, which is the case for URLs with a host, e.g.
+// //example.com/a.png, and for URLs with a scheme other than cid: and data:, as browsers also load e.g.
+// http:example.com/a.png from the host. URLs that can't be parsed are remote.
+func isRemoteURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return true
+	}
+
+	if parsed.Host != "" {
+		return true
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "cid", "data":
+		return false
+	}
+
+	return true
+}
+
+// sanitizeCSS removes dangerous declarations from a style attribute and blocks or rewrites the urls in the rest
+func (s *sanitizer) sanitizeCSS(css string) string {
+	var kept []string
+	for _, decl := range splitCSSDeclarations(css) {
+		decl = strings.TrimSpace(decl)
+		if decl == "" {
+			continue
+		}
+
+		if cssDangerousRe.MatchString(decl) || strings.Contains(decl, "\\") {
+			s.report.RemovedCSS = appendUnique(s.report.RemovedCSS, decl)
+			continue
+		}
+
+		sanitized, ok := s.sanitizeCSSURLs(decl)
+		if !ok {
+			s.report.RemovedCSS = appendUnique(s.report.RemovedCSS, decl)
+			continue
+		}
+
+		kept = append(kept, sanitized)
+	}
+
+	return strings.Join(kept, "; ")
+}
+
+// splitCSSDeclarations splits a style attribute on the semicolons outside of strings and parentheses
+func splitCSSDeclarations(css string) (decls []string) {
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			decls = append(decls, css[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(decls, css[start:])
+}
+
+// sanitizeCSSURLs passes the URLs of a declaration through the policy, those of url() and the strings of the
+// functions taking URLs. ok is false when a URL is blocked or can't be told apart from the rest of the declaration.
+func (s *sanitizer) sanitizeCSSURLs(decl string) (string, bool) {
+	var b strings.Builder
+	var functions []string
+	for i := 0; i < len(decl); {
+		c := decl[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(decl[i+1:], c)
+			if end < 0 {
+				return "", false
+			}
+
+			str := decl[i+1 : i+1+end]
+			if len(functions) > 0 && cssURLFunctions[functions[len(functions)-1]] {
+				u, ok := s.resourceURL(str, true)
+				if !ok {
+					return "", false
+				}
+
+				b.WriteString("'" + strings.Replace(u, "'", "%27", -1) + "'")
+			} else {
+				b.WriteString(decl[i : i+end+2])
+			}
+
+			i += end + 2
+		case c == '(':
+			name := cssFunctionName(decl[:i])
+			if name == "url" {
+				end := strings.IndexByte(decl[i:], ')')
+				if end < 0 {
+					return "", false
+				}
+
+				u := strings.TrimSpace(decl[i+1 : i+end])
+				if len(u) >= 2 && (u[0] == '"' || u[0] == '\'') && u[len(u)-1] == u[0] {
+					u = u[1 : len(u)-1]
+				}
+
+				if strings.ContainsAny(u, "\"'()") {
+					return "", false
+				}
+
+				u, ok := s.resourceURL(u, true)
+				if !ok {
+					return "", false
+				}
+
+				b.WriteString("('" + strings.Replace(u, "'", "%27", -1) + "')")
+				i += end + 1
+				continue
+			}
+
+			// the URL strings of variables and attributes aren't known until the style is computed
+			if (name == "var" || name == "attr" || name == "env") && inCSSURLFunction(functions) {
+				return "", false
+			}
+
+			functions = append(functions, name)
+			b.WriteByte(c)
+			i++
+		case c == ')':
+			if len(functions) > 0 {
+				functions = functions[:len(functions)-1]
+			}
+
+			b.WriteByte(c)
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String(), true
+}
+
+// cssFunctionName returns the lower cased identifier ending the CSS, the name of the function whose parenthesis follows
+func cssFunctionName(css string) string {
+	i := len(css)
+	for i > 0 {
+		c := css[i-1]
+		if c != '-' && c != '_' && !isASCIILetter(c) && (c < '0' || c > '9') {
+			break
+		}
+
+		i--
+	}
+
+	return strings.ToLower(css[i:])
+}
+
+func inCSSURLFunction(functions []string) bool {
+	for _, f := range functions {
+		if cssURLFunctions[f] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stripControl removes the whitespace and control characters browsers ignore in URLs, e.g. "java\tscript:"
+func stripControl(u string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+
+		return r
+	}, u)
+}
+
+func isVoidElement(name string) bool {
+	switch name {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr":
+		return true
+	}
+
+	return false
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+
+	return append(list, s)
+}
@@ -0,0 +1,144 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	proxy := DefaultSanitizePolicy()
+	proxy.ExternalResources = func(url string) string {
+		if strings.Contains(url, "tracker") {
+			return ""
+		}
+
+		return "https://proxy.example/?u=" + url
+	}
+
+	var testData = map[int]struct {
+		html   string
+		policy SanitizePolicy
+		result string
+		report SanitizeReport
+	}{
+		1: {
+			html:   `<html><head><style>body{}</style></head><body onload="x()"><p class="a" onclick="alert(1)">Hi <b>there</b></p><script>alert("</p>")</script></body></html>`,
+			policy: DefaultSanitizePolicy(),
+			result: `<p class="a">Hi <b>there</b></p>`,
+			report: SanitizeReport{
+				RemovedTags:       []string{"html", "head", "body", "script"},
+				RemovedAttributes: []string{"p.onclick"},
+			},
+		},
+		2: {
+			html:   `<a href="java&#x09;script:alert(1)">x</a><a href="https://example.com/?a=1&amp;b=2" target="_blank">y</a><form action="/x"><input name="q"><button>Go</button>text</form><iframe src="https://evil.example/"><p>inner</p></iframe>`,
+			policy: DefaultSanitizePolicy(),
+			result: `<a>x</a><a href="https://example.com/?a=1&amp;b=2">y</a>text`,
+			report: SanitizeReport{
+				RemovedTags:       []string{"form", "input", "button", "iframe"},
+				RemovedAttributes: []string{"a.target"},
+				BlockedURLs:       []string{"java\tscript:alert(1)"},
+			},
+		},
+		3: {
+			html:   `<img src="https://img.example/a.png" alt="A"><img src="https://tracker.example/p.gif"><img src="cid:logo"><div style="color: red; background: url(https://img.example/bg.png); width: expression(alert(1))">z</div>`,
+			policy: proxy,
+			result: `<img src="https://proxy.example/?u=https://img.example/a.png" alt="A"><img><img src="cid:logo"><div style="color: red; background: url(&#39;https://proxy.example/?u=https://img.example/bg.png&#39;)">z</div>`,
+			report: SanitizeReport{
+				BlockedURLs:   []string{"https://tracker.example/p.gif"},
+				RewrittenURLs: []string{"https://img.example/a.png", "https://img.example/bg.png"},
+				RemovedCSS:    []string{"width: expression(alert(1))"},
+			},
+		},
+		4: {
+			html:   `<img src="https://img.example/a.png"><img src="data:image/png;base64,AAAA"><a href="data:text/html,x">d</a>`,
+			policy: DefaultSanitizePolicy(),
+			result: `<img><img src="data:image/png;base64,AAAA"><a>d</a>`,
+			report: SanitizeReport{
+				BlockedURLs: []string{"https://img.example/a.png", "data:text/html,x"},
+			},
+		},
+		5: {
+			html:   `<div style="background:url('http://evil.example/x;y'); color: red">a</div>`,
+			policy: DefaultSanitizePolicy(),
+			result: `<div style="color: red">a</div>`,
+			report: SanitizeReport{
+				BlockedURLs: []string{"http://evil.example/x;y"},
+				RemovedCSS:  []string{"background:url('http://evil.example/x;y')"},
+			},
+		},
+		6: {
+			html:   `<div style="background-image: image-set('http://evil.example/x' 1x); color: red; background: Image(var(--x))">b</div>`,
+			policy: DefaultSanitizePolicy(),
+			result: `<div style="color: red">b</div>`,
+			report: SanitizeReport{
+				BlockedURLs: []string{"http://evil.example/x"},
+				RemovedCSS:  []string{"background-image: image-set('http://evil.example/x' 1x)", "background: Image(var(--x))"},
+			},
+		},
+		7: {
+			html:   `<div style='background-image: -webkit-image-set(url("https://img.example/a.png") 1x, "https://img.example/b.png" 2x); font-family: "A;B"'>c</div>`,
+			policy: proxy,
+			result: `<div style="background-image: -webkit-image-set(url(&#39;https://proxy.example/?u=https://img.example/a.png&#39;) 1x, &#39;https://proxy.example/?u=https://img.example/b.png&#39; 2x); font-family: &#34;A;B&#34;">c</div>`,
+			report: SanitizeReport{
+				RewrittenURLs: []string{"https://img.example/a.png", "https://img.example/b.png"},
+			},
+		},
+		8: {
+			html:   `<div style="@import 'http://evil.example/x.css'; color: red">d</div>`,
+			policy: DefaultSanitizePolicy(),
+			result: `<div style="color: red">d</div>`,
+			report: SanitizeReport{
+				RemovedCSS: []string{"@import 'http://evil.example/x.css'"},
+			},
+		},
+		9: {
+			// URLs browsers load from the host although they don't start with http://, https:// or //
+			html:   `<img src="\\evil.example/p.png"><img src="/\evil.example/p.png"><img src="http:evil.example/p.png"><img src="https:\\evil.example/p.png"><img src="/local.png">`,
+			policy: DefaultSanitizePolicy(),
+			result: `<img><img><img><img><img src="/local.png">`,
+			report: SanitizeReport{
+				BlockedURLs: []string{`\\evil.example/p.png`, `/\evil.example/p.png`, "http:evil.example/p.png", `https:\\evil.example/p.png`},
+			},
+		},
+		10: {
+			html:   `<table><tr><td background="http:evil.example/bg.png">e</td></tr></table><div style="background:url(http:evil.example/x.png); color: red">f</div>`,
+			policy: DefaultSanitizePolicy(),
+			result: `<table><tr><td>e</td></tr></table><div style="color: red">f</div>`,
+			report: SanitizeReport{
+				BlockedURLs: []string{"http:evil.example/bg.png", "http:evil.example/x.png"},
+				RemovedCSS:  []string{"background:url(http:evil.example/x.png)"},
+			},
+		},
+		11: {
+			html:   `<img src="\\img.example/a.png">`,
+			policy: proxy,
+			result: `<img src="https://proxy.example/?u=//img.example/a.png">`,
+			report: SanitizeReport{
+				RewrittenURLs: []string{`\\img.example/a.png`},
+			},
+		},
+	}
+
+	for index, td := range testData {
+		result, report := SanitizeHTML(td.html, td.policy)
+		if td.result != result {
+			t.Errorf("[Test Case %v] Wrong result. Expected: '%s', Got: '%s'", index, td.result, result)
+		}
+
+		for _, c := range []struct {
+			name             string
+			expected, actual []string
+		}{
+			{"removed tags", td.report.RemovedTags, report.RemovedTags},
+			{"removed attributes", td.report.RemovedAttributes, report.RemovedAttributes},
+			{"blocked urls", td.report.BlockedURLs, report.BlockedURLs},
+			{"rewritten urls", td.report.RewrittenURLs, report.RewrittenURLs},
+			{"removed css", td.report.RemovedCSS, report.RemovedCSS},
+		} {
+			if !assertSliceEq(c.expected, c.actual) {
+				t.Errorf("[Test Case %v] Wrong %s. Expected: %q, Got: %q", index, c.name, c.expected, c.actual)
+			}
+		}
+	}
+}
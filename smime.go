@@ -0,0 +1,414 @@
+package parsemail
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+const contentTypeMultipartSigned = "multipart/signed"
+
+// maxSecurityLayers limits the nesting of signed and encrypted entities
+const maxSecurityLayers = 8
+
+var (
+	errInvalidSMIME = errors.New("invalid S/MIME message")
+	errSMIMENoKey   = errors.New("S/MIME message is encrypted but no decryption key was provided")
+	errSMIMESender  = errors.New("S/MIME signer certificate is not issued to the From address")
+)
+
+// SMIMEOptions with the certificates and the key used to verify and decrypt S/MIME messages
+type SMIMEOptions struct {
+	// Roots the signer certificates must chain to, the system roots when nil
+	Roots *x509.CertPool
+	// Time at which the certificates must be valid, the current time when zero
+	Time time.Time
+	// AtSigningTime checks the certificates at the signing time of each signature instead, e.g. for archived messages
+	// signed with certificates that have expired since. The signer chooses the signing time, so an expired or not yet
+	// valid certificate is accepted when the signer backdates it.
+	AtSigningTime bool
+	// Certificate identifies the recipient of encrypted messages, when nil all recipients are tried with the Key
+	Certificate *x509.Certificate
+	// Key decrypts encrypted messages, e.g. an *rsa.PrivateKey
+	Key crypto.Decrypter
+}
+
+// SMIME with the security layers of an S/MIME message
+type SMIME struct {
+	Signed    bool
+	Encrypted bool
+	Signers   []SMIMESigner
+}
+
+// SMIMESigner with the certificate of a signer and the result of the verification of its signature
+type SMIMESigner struct {
+	Certificate *x509.Certificate
+	SigningTime time.Time
+	// Err is the reason the signature or the certificate is not valid, nil when verified
+	Err error
+}
+
+// Verified reports whether the message is signed and all signatures are valid, with signer certificates issued to
+// a From address of the message
+func (s SMIME) Verified() bool {
+	if !s.Signed || len(s.Signers) == 0 {
+		return false
+	}
+
+	for _, signer := range s.Signers {
+		if signer.Err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseSMIME parses an email message which may be signed (multipart/signed or application/pkcs7-mime signed-data)
+// and/or encrypted (application/pkcs7-mime enveloped-data). Signatures are verified and reported in the SMIME of the
+// email rather than failing the parsing, encrypted content is decrypted with the key of the options. The protected
+// entity is parsed into the bodies and attachments of the email, with the header fields of the outer message.
+// Autocrypt-Gossip headers of decrypted entities are reported in AutocryptGossip.
+func ParseSMIME(r io.Reader, opts SMIMEOptions) (email Email, err error) {
+	return Parser{}.ParseSMIME(r, opts)
+}
+
+// ParseSMIME parses an email message like the package ParseSMIME, within the limits and with the content handlers.
+// Decrypted and unwrapped entities count towards the size of the message and security layers towards its nesting.
+func (p Parser) ParseSMIME(r io.Reader, opts SMIMEOptions) (email Email, err error) {
+	return p.ParseSMIMEContext(context.Background(), r, opts)
+}
+
+// ParseSMIMEContext parses an email message like ParseSMIME, returning ctx.Err() once the context is done.
+// Cancellation is also checked before each security layer is verified or decrypted.
+func (p Parser) ParseSMIMEContext(ctx context.Context, r io.Reader, opts SMIMEOptions) (email Email, err error) {
+	s := &parseState{ctx: ctx, limits: p.Limits, handlers: p.Handlers}
+
+	email, err = s.parseSMIME(r, opts)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return Email{}, ctxErr
+	}
+
+	return
+}
+
+func (s *parseState) parseSMIME(r io.Reader, opts SMIMEOptions) (email Email, err error) {
+	raw, err := s.readMessage(r)
+	if err != nil {
+		return
+	}
+
+	info := &SMIME{}
+	var gossip []Autocrypt
+	for i := 0; i < maxSecurityLayers; i++ {
+		if err = s.ctx.Err(); err != nil {
+			return
+		}
+
+		var inner []byte
+		var layerGossip []Autocrypt
+		inner, layerGossip, err = unwrapSMIME(raw, opts, info)
+		if err != nil {
+			return
+		}
+
+		gossip = append(gossip, layerGossip...)
+
+		if inner == nil {
+			break
+		}
+
+		if err = s.enterMultipart(); err != nil {
+			return
+		}
+
+		if err = s.expand(len(inner)); err != nil {
+			return
+		}
+
+		raw = inner
+	}
+
+	email, err = s.parseNested(raw)
+	if err != nil {
+		return
+	}
+
+	checkSignerAddresses(info.Signers, email.From)
+
+	if info.Signed || info.Encrypted {
+		email.SMIME = info
+	}
+
+	email.AutocryptGossip = gossip
+
+	return
+}
+
+// unwrapSMIME verifies or decrypts the outermost security layer of the message and returns the protected entity with
+// the header fields of the message, or nil when the message has no S/MIME layer, along with the Autocrypt-Gossip
+// headers of decrypted entities
+func unwrapSMIME(raw []byte, opts SMIMEOptions, info *SMIME) (inner []byte, gossip []Autocrypt, err error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contentType, params, err := parseContentType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case contentType == contentTypeMultipartSigned && isPKCS7Type(params["protocol"], "signature"):
+		body, err := ioutil.ReadAll(msg.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		parts, err := splitMultipart(body, params["boundary"])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(parts) != 2 {
+			return nil, nil, errInvalidSMIME
+		}
+
+		ci, err := readCMSEntity(parts[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !ci.ContentType.Equal(oidSignedData) {
+			return nil, nil, errInvalidSMIME
+		}
+
+		// signatures are computed over the canonical form of the entity, with CRLF line endings
+		_, signers, err := verifySignedData(ci.Content, canonicalLineEndings(parts[0]), opts.Roots, opts.Time, opts.AtSigningTime)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		info.Signed = true
+		info.Signers = append(info.Signers, smimeSigners(signers)...)
+		inner = parts[0]
+	case isPKCS7Type(contentType, "mime"):
+		ci, err := readCMSEntity(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case ci.ContentType.Equal(oidSignedData):
+			data, signers, err := verifySignedData(ci.Content, nil, opts.Roots, opts.Time, opts.AtSigningTime)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			info.Signed = true
+			info.Signers = append(info.Signers, smimeSigners(signers)...)
+			inner = data
+		case ci.ContentType.Equal(oidEnvelopedData):
+			if opts.Key == nil {
+				return nil, nil, errSMIMENoKey
+			}
+
+			inner, err = decryptEnvelopedData(ci.Content, opts.Certificate, opts.Key)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			info.Encrypted = true
+			gossip = parseEntityGossip(inner)
+		default:
+			// e.g. certs-only messages
+			return nil, nil, nil
+		}
+	default:
+		return nil, nil, nil
+	}
+
+	// the protected entity is in canonical form, with CRLF line endings
+	inner = bytes.Replace(inner, []byte("\r\n"), []byte("\n"), -1)
+
+	inner, err = mergeEntityHeader(msg.Header, inner)
+
+	return inner, gossip, err
+}
+
+// isPKCS7Type reports whether the media type is application/pkcs7-<subtype> or its legacy x- variant
+func isPKCS7Type(mediaType string, subtype string) bool {
+	mediaType = strings.ToLower(mediaType)
+
+	return mediaType == "application/pkcs7-"+subtype || mediaType == "application/x-pkcs7-"+subtype
+}
+
+// readCMSEntity decodes the CMS content of a MIME entity
+func readCMSEntity(entity []byte) (ci cmsContentInfo, err error) {
+	_, data, err := readEntity(entity)
+	if err != nil {
+		return
+	}
+
+	return parseCMS(data)
+}
+
+// readEntity returns the header and the decoded body of a MIME entity
+func readEntity(entity []byte) (mail.Header, []byte, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(entity))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoded, err := decodeContent(msg.Body, strings.ToLower(msg.Header.Get("Content-Transfer-Encoding")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ioutil.ReadAll(decoded)
+
+	return msg.Header, data, err
+}
+
+func smimeSigners(signers []cmsSigner) []SMIMESigner {
+	var result []SMIMESigner
+	for _, signer := range signers {
+		result = append(result, SMIMESigner{
+			Certificate: signer.certificate,
+			SigningTime: signer.signingTime,
+			Err:         signer.err,
+		})
+	}
+
+	return result
+}
+
+// checkSignerAddresses fails the valid signatures whose signer certificate isn't issued to one of the From addresses
+// (RFC 8550 section 3), by its subject alternative names or the email address of its subject
+func checkSignerAddresses(signers []SMIMESigner, from []*mail.Address) {
+	for i, signer := range signers {
+		if signer.Err != nil {
+			continue
+		}
+
+		addresses := signer.Certificate.EmailAddresses
+		for _, name := range signer.Certificate.Subject.Names {
+			if value, ok := name.Value.(string); ok && name.Type.Equal(oidEmailAddress) {
+				addresses = append(addresses, value)
+			}
+		}
+
+		matched := false
+		for _, address := range addresses {
+			for _, f := range from {
+				matched = matched || strings.EqualFold(address, f.Address)
+			}
+		}
+
+		if !matched {
+			signers[i].Err = errSMIMESender
+		}
+	}
+}
+
+// splitMultipart returns the raw body parts of a multipart body, as needed to verify signatures over them
+func splitMultipart(body []byte, boundary string) ([][]byte, error) {
+	if boundary == "" {
+		return nil, errInvalidSMIME
+	}
+
+	delimiter := []byte("--" + boundary)
+
+	var parts [][]byte
+	start := -1
+	for off := 0; off < len(body); {
+		end := len(body)
+		if i := bytes.IndexByte(body[off:], '\n'); i >= 0 {
+			end = off + i + 1
+		}
+
+		line := body[off:end]
+		if bytes.HasPrefix(line, delimiter) {
+			rest := bytes.TrimRight(line[len(delimiter):], " \t\r\n")
+			if len(rest) == 0 || string(rest) == "--" {
+				if start >= 0 {
+					// the line break preceding the delimiter is part of the delimiter
+					part := bytes.TrimSuffix(body[start:off], []byte("\n"))
+					parts = append(parts, bytes.TrimSuffix(part, []byte("\r")))
+				}
+
+				if len(rest) > 0 {
+					return parts, nil
+				}
+
+				start = end
+			}
+		}
+
+		off = end
+	}
+
+	return nil, errInvalidSMIME
+}
+
+// canonicalLineEndings converts bare LF line endings to CRLF
+func canonicalLineEndings(b []byte) []byte {
+	if !bytes.Contains(b, []byte("\n")) || bytes.Count(b, []byte("\r\n")) == bytes.Count(b, []byte("\n")) {
+		return b
+	}
+
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+
+	return bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1)
+}
+
+// parseEntityGossip returns the Autocrypt-Gossip headers of a decrypted entity
+func parseEntityGossip(entity []byte) []Autocrypt {
+	msg, err := mail.ReadMessage(bytes.NewReader(entity))
+	if err != nil {
+		return nil
+	}
+
+	return parseAutocryptGossip(msg.Header)
+}
+
+// mergeEntityHeader prepends the header fields of the outer message to the protected entity. The content fields of
+// the outer message are dropped, fields of the entity take precedence over those of the outer message.
+func mergeEntityHeader(header mail.Header, entity []byte) ([]byte, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(entity))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "content-") || lower == "mime-version" || len(msg.Header[key]) > 0 {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, key := range keys {
+		for _, value := range header[key] {
+			b.WriteString(key + ": " + value + "\r\n")
+		}
+	}
+
+	b.Write(entity)
+
+	return b.Bytes(), nil
+}
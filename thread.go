@@ -0,0 +1,304 @@
+package parsemail
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Thread is a message in a conversation tree. Messages that are referenced but not among the threaded emails, and
+// containers grouping messages with the same subject, are represented by threads without Email.
+type Thread struct {
+	MessageID string
+	Email     *Email
+	Parent    *Thread
+	Children  []*Thread
+}
+
+// Threader builds conversation threads from a stream of emails
+type Threader struct {
+	emails []Email
+}
+
+// NewThreader returns an empty Threader
+func NewThreader() *Threader {
+	return &Threader{}
+}
+
+// Add adds the email to the threader
+func (t *Threader) Add(email Email) {
+	t.emails = append(t.emails, email)
+}
+
+// Threads returns the conversation threads of the emails added so far, see ThreadEmails
+func (t *Threader) Threads() []*Thread {
+	return ThreadEmails(t.emails)
+}
+
+// subjectPrefixRe matches reply and forward prefixes (including counters like "Re[2]:") and [list] tags
+var subjectPrefixRe = regexp.MustCompile(`(?i)^\s*(\[[^\]]*\]|(re|fw|fwd|aw|sv|vs|antw|wg|tr|rif|r|odp|res|enc|ynt)\s*(\[\d+\]|\(\d+\))?\s*:)\s*`)
+var subjectForwardSuffixRe = regexp.MustCompile(`(?i)\s*\(fwd\)\s*$`)
+
+// BaseSubject returns the subject without reply and forward prefixes (Re:, Fwd:, AW:, SV:, ...), [list] tags and
+// "(fwd)" suffixes, used to group messages of the same conversation
+func BaseSubject(subject string) string {
+	s, _ := baseSubject(subject)
+
+	return s
+}
+
+// baseSubject returns the base subject and whether a reply or forward prefix was removed from it
+func baseSubject(subject string) (string, bool) {
+	s := strings.Join(strings.Fields(subject), " ")
+	reply := false
+
+	for {
+		trimmed := subjectForwardSuffixRe.ReplaceAllString(s, "")
+		if m := subjectPrefixRe.FindStringSubmatch(trimmed); m != nil {
+			if m[2] != "" {
+				reply = true
+			}
+
+			trimmed = trimmed[len(m[0]):]
+		}
+
+		if trimmed == s {
+			return s, reply
+		}
+
+		s = trimmed
+	}
+}
+
+// ThreadEmails groups the emails into conversation threads using the JWZ algorithm
+// (https://www.jwz.org/doc/threading.html). Messages are linked by their References and In-Reply-To headers;
+// threads without references to each other are grouped by their base subject. The returned threads and their
+// children are sorted by date.
+func ThreadEmails(emails []Email) []*Thread {
+	ids := map[string]*Thread{}
+	var nodes []*Thread
+
+	get := func(id string) *Thread {
+		t, ok := ids[id]
+		if !ok {
+			t = &Thread{MessageID: id}
+			ids[id] = t
+			nodes = append(nodes, t)
+		}
+
+		return t
+	}
+
+	for i := range emails {
+		email := &emails[i]
+
+		var node *Thread
+		if t, ok := ids[email.MessageID]; email.MessageID == "" || (ok && t.Email != nil) {
+			// messages without or with duplicate ids can't be referenced
+			node = &Thread{MessageID: email.MessageID}
+			nodes = append(nodes, node)
+		} else {
+			node = get(email.MessageID)
+		}
+
+		node.Email = email
+
+		var parent *Thread
+		for _, ref := range threadReferences(*email) {
+			t := get(ref)
+			if parent != nil && t.Parent == nil && t != parent && !parent.hasAncestor(t) {
+				parent.link(t)
+			}
+
+			parent = t
+		}
+
+		// the references of the message itself take precedence over the links made by other messages
+		if node.Parent != nil {
+			node.unlink()
+		}
+
+		if parent != nil && parent != node && !parent.hasAncestor(node) {
+			parent.link(node)
+		}
+	}
+
+	var roots []*Thread
+	for _, t := range nodes {
+		if t.Parent == nil {
+			roots = append(roots, t)
+		}
+	}
+
+	roots = groupBySubject(pruneThreads(roots, true))
+	sortThreads(roots)
+
+	return roots
+}
+
+// threadReferences returns the ids of the ancestors of the email, from the root of its thread
+func threadReferences(email Email) []string {
+	var refs []string
+	for _, ref := range email.References {
+		if ref != "" && ref != email.MessageID {
+			refs = append(refs, ref)
+		}
+	}
+
+	if len(email.InReplyTo) > 0 && email.InReplyTo[0] != email.MessageID {
+		found := false
+		for _, ref := range refs {
+			found = found || ref == email.InReplyTo[0]
+		}
+
+		if !found {
+			refs = append(refs, email.InReplyTo[0])
+		}
+	}
+
+	return refs
+}
+
+func (t *Thread) link(child *Thread) {
+	child.Parent = t
+	t.Children = append(t.Children, child)
+}
+
+func (t *Thread) unlink() {
+	siblings := t.Parent.Children
+	for i, c := range siblings {
+		if c == t {
+			t.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+
+	t.Parent = nil
+}
+
+func (t *Thread) hasAncestor(ancestor *Thread) bool {
+	for p := t.Parent; p != nil; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pruneThreads removes threads without email and children and replaces threads without email by their children,
+// except at the root level where this is only done for a single child
+func pruneThreads(threads []*Thread, root bool) []*Thread {
+	var pruned []*Thread
+	for _, t := range threads {
+		t.Children = pruneThreads(t.Children, false)
+		if t.Email == nil && (len(t.Children) == 0 || !root || len(t.Children) == 1) {
+			for _, c := range t.Children {
+				c.Parent = t.Parent
+				pruned = append(pruned, c)
+			}
+
+			continue
+		}
+
+		pruned = append(pruned, t)
+	}
+
+	return pruned
+}
+
+// groupBySubject merges the root threads with the same base subject
+func groupBySubject(roots []*Thread) []*Thread {
+	subjects := map[string]*Thread{}
+	for _, r := range roots {
+		subject, _ := r.subject()
+		if subject == "" {
+			continue
+		}
+
+		key := strings.ToLower(subject)
+		old, ok := subjects[key]
+		if !ok || (old.Email != nil && r.Email == nil) || (old.Email != nil && r.Email != nil && old.isReply() && !r.isReply()) {
+			subjects[key] = r
+		}
+	}
+
+	var grouped []*Thread
+	for _, r := range roots {
+		subject, _ := r.subject()
+		other := subjects[strings.ToLower(subject)]
+		if subject == "" || other == nil || other == r {
+			grouped = append(grouped, r)
+			continue
+		}
+
+		switch {
+		case other.Email == nil && r.Email == nil:
+			for _, c := range r.Children {
+				other.link(c)
+			}
+		case other.Email == nil || (!other.isReply() && r.isReply()):
+			other.link(r)
+		default:
+			// keep other in place as the container of both threads
+			moved := *other
+			for _, c := range moved.Children {
+				c.Parent = &moved
+			}
+
+			*other = Thread{}
+			other.link(&moved)
+			other.link(r)
+		}
+	}
+
+	return grouped
+}
+
+// subject returns the base subject of the thread, taken from the first email in it
+func (t *Thread) subject() (string, bool) {
+	if t.Email != nil {
+		return baseSubject(t.Email.Subject)
+	}
+
+	for _, c := range t.Children {
+		if s, reply := c.subject(); s != "" {
+			return s, reply
+		}
+	}
+
+	return "", false
+}
+
+func (t *Thread) isReply() bool {
+	_, reply := t.subject()
+
+	return reply
+}
+
+// date returns the date of the email of the thread or the earliest date of its children
+func (t *Thread) date() time.Time {
+	if t.Email != nil {
+		return t.Email.Date
+	}
+
+	var date time.Time
+	for _, c := range t.Children {
+		if d := c.date(); date.IsZero() || (!d.IsZero() && d.Before(date)) {
+			date = d
+		}
+	}
+
+	return date
+}
+
+func sortThreads(threads []*Thread) {
+	for _, t := range threads {
+		sortThreads(t.Children)
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].date().Before(threads[j].date())
+	})
+}
@@ -0,0 +1,145 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBaseSubject(t *testing.T) {
+	var testData = map[int]struct {
+		subject string
+		base    string
+		reply   bool
+	}{
+		1: {subject: "Meeting", base: "Meeting"},
+		2: {subject: "Re: Meeting", base: "Meeting", reply: true},
+		3: {subject: "RE: Fwd: re:  Meeting", base: "Meeting", reply: true},
+		4: {subject: "AW: SV: Meeting", base: "Meeting", reply: true},
+		5: {subject: "[golang-nuts] Re: Meeting", base: "Meeting", reply: true},
+		6: {subject: "Re[2]: [list] Meeting (fwd)", base: "Meeting", reply: true},
+		7: {subject: "[list] Meeting", base: "Meeting"},
+		8: {subject: "Reminder: Meeting", base: "Reminder: Meeting"},
+	}
+
+	for index, td := range testData {
+		base, reply := baseSubject(td.subject)
+		if base != td.base {
+			t.Errorf("[Test Case %v] Wrong base subject. Expected: '%s', Got: '%s'", index, td.base, base)
+		}
+
+		if reply != td.reply {
+			t.Errorf("[Test Case %v] Wrong reply. Expected: %v, Got: %v", index, td.reply, reply)
+		}
+	}
+}
+
+func TestThreadEmails(t *testing.T) {
+	date := func(hour int) time.Time {
+		return time.Date(2019, 3, 4, hour, 0, 0, 0, time.UTC)
+	}
+
+	var testData = map[int]struct {
+		emails []Email
+		tree   string
+	}{
+		1: {
+			emails: []Email{
+				{MessageID: "c", Subject: "Re: A", Date: date(3), References: []string{"a", "b"}},
+				{MessageID: "a", Subject: "A", Date: date(1)},
+				{MessageID: "b", Subject: "Re: A", Date: date(2), InReplyTo: []string{"a"}},
+				{MessageID: "d", Subject: "Re: A", Date: date(4), InReplyTo: []string{"a"}},
+			},
+			tree: "(a (b (c)) (d))",
+		},
+		2: {
+			// the common ancestor is missing
+			emails: []Email{
+				{MessageID: "b", Subject: "Re: A", Date: date(2), References: []string{"a"}},
+				{MessageID: "c", Subject: "Re: A", Date: date(3), References: []string{"a"}},
+			},
+			tree: "(- (b) (c))",
+		},
+		3: {
+			// a single missing ancestor is pruned
+			emails: []Email{
+				{MessageID: "c", Subject: "Re: A", Date: date(3), References: []string{"a", "b"}},
+			},
+			tree: "(c)",
+		},
+		4: {
+			// grouped by subject
+			emails: []Email{
+				{MessageID: "a", Subject: "Lunch", Date: date(1)},
+				{MessageID: "b", Subject: "RE: [team] lunch", Date: date(2)},
+				{MessageID: "x", Subject: "Other", Date: date(3)},
+			},
+			tree: "(a (b)) (x)",
+		},
+		5: {
+			// two originals with the same subject are kept under a common container
+			emails: []Email{
+				{MessageID: "a", Subject: "Report", Date: date(1)},
+				{MessageID: "b", Subject: "Report", Date: date(2)},
+				{MessageID: "c", Subject: "Re: Report", Date: date(3)},
+			},
+			tree: "(- (a) (b) (c))",
+		},
+		6: {
+			// reference loops are ignored
+			emails: []Email{
+				{MessageID: "a", Subject: "A", Date: date(1), References: []string{"b"}},
+				{MessageID: "b", Subject: "B", Date: date(2), References: []string{"a"}},
+			},
+			tree: "(b (a))",
+		},
+		7: {
+			// duplicate ids
+			emails: []Email{
+				{MessageID: "a", Subject: "A", Date: date(1)},
+				{MessageID: "a", Subject: "B", Date: date(2)},
+			},
+			tree: "(a) (a)",
+		},
+	}
+
+	for index, td := range testData {
+		tree := formatThreads(ThreadEmails(td.emails))
+		if tree != td.tree {
+			t.Errorf("[Test Case %v] Wrong threads. Expected: '%s', Got: '%s'", index, td.tree, tree)
+		}
+	}
+}
+
+func TestThreader(t *testing.T) {
+	threader := NewThreader()
+	threader.Add(Email{MessageID: "a", Subject: "A"})
+	threader.Add(Email{MessageID: "b", Subject: "B", InReplyTo: []string{"a"}})
+
+	threads := threader.Threads()
+	if tree := formatThreads(threads); tree != "(a (b))" {
+		t.Errorf("Wrong threads. Expected: '(a (b))', Got: '%s'", tree)
+	}
+
+	if threads[0].Children[0].Parent != threads[0] {
+		t.Errorf("Wrong parent of thread")
+	}
+}
+
+func formatThreads(threads []*Thread) string {
+	var s []string
+	for _, t := range threads {
+		id := "-"
+		if t.Email != nil {
+			id = t.Email.MessageID
+		}
+
+		if len(t.Children) > 0 {
+			id += " " + formatThreads(t.Children)
+		}
+
+		s = append(s, "("+id+")")
+	}
+
+	return strings.Join(s, " ")
+}
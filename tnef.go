@@ -0,0 +1,245 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+// TNEF with the content of a TNEF (winmail.dat) attachment sent by Outlook and Exchange
+type TNEF struct {
+	MessageClass string
+	Subject      string
+	Date         time.Time
+	Body         string
+	BodyHTML     string
+	// CompressedRTF is the compressed RTF body of the message
+	CompressedRTF []byte
+	Attachments   []Attachment
+	// Properties are the MAPI properties of the message
+	Properties []MAPIProperty
+}
+
+const tnefSignature = 0x223E9F78
+
+const (
+	tnefLevelMessage    = 1
+	tnefLevelAttachment = 2
+)
+
+const (
+	tnefAttributeSubject        = 0x00018004
+	tnefAttributeDateSent       = 0x00038005
+	tnefAttributeMessageClass   = 0x00078008
+	tnefAttributeBody           = 0x0002800C
+	tnefAttributeAttachData     = 0x0006800F
+	tnefAttributeAttachTitle    = 0x00018010
+	tnefAttributeAttachRendData = 0x00069002
+	tnefAttributeMsgProps       = 0x00069003
+	tnefAttributeAttachment     = 0x00069005
+)
+
+var errInvalidTNEF = errors.New("invalid TNEF data")
+
+// isTNEFAttachment checks the content type and the filename of the attachment, as some clients send winmail.dat
+// files as application/octet-stream
+func isTNEFAttachment(at Attachment) bool {
+	contentType, _, _ := mime.ParseMediaType(at.ContentType)
+
+	return contentType == "application/ms-tnef" || contentType == "application/vnd.ms-tnef" ||
+		strings.EqualFold(path.Base(at.Filename), "winmail.dat")
+}
+
+// decodeTNEFAttachments replaces TNEF attachments by the attachments they contain and sets the TNEF of the email to
+// the first of them, whose bodies are used when the email has none. TNEF attachments that can't be decoded are kept
+// as they are.
+func (s *parseState) decodeTNEFAttachments(email *Email) error {
+	var attachments []Attachment
+	for _, at := range email.Attachments {
+		if !isTNEFAttachment(at) {
+			attachments = append(attachments, at)
+			continue
+		}
+
+		data, err := readData(at.Data)
+		if err != nil {
+			return err
+		}
+
+		tnef, err := ParseTNEF(data)
+		if err != nil {
+			attachments = append(attachments, at)
+			continue
+		}
+
+		// the bodies may be decompressed from RTF
+		if err := s.expand(len(tnef.Body) + len(tnef.BodyHTML)); err != nil {
+			return err
+		}
+
+		if email.TNEF == nil {
+			email.TNEF = tnef
+
+			if email.HTMLBody == "" {
+				email.HTMLBody = tnef.BodyHTML
+			}
+
+			if email.TextBody == "" {
+				email.TextBody = tnef.Body
+			}
+		}
+
+		attachments = append(attachments, tnef.Attachments...)
+	}
+
+	email.Attachments = attachments
+
+	return nil
+}
+
+// ParseTNEF decodes a TNEF stream, e.g. the content of a winmail.dat attachment
+func ParseTNEF(data []byte) (*TNEF, error) {
+	r := &leReader{b: data}
+	if r.uint32() != tnefSignature {
+		return nil, errInvalidTNEF
+	}
+
+	// legacy key
+	r.uint16()
+
+	tnef := &TNEF{}
+
+	var at *Attachment
+	var atProps []MAPIProperty
+	finishAttachment := func() {
+		if at != nil {
+			tnef.Attachments = append(tnef.Attachments, tnefAttachment(*at, atProps))
+		}
+
+		at = nil
+		atProps = nil
+	}
+
+	for r.err == nil && r.off < len(r.b) {
+		level := r.next(1)
+		id := r.uint32()
+		length := int(r.uint32())
+		value := r.next(length)
+		checksum := r.uint16()
+		if r.err != nil {
+			return nil, errInvalidTNEF
+		}
+
+		if tnefChecksum(value) != checksum {
+			return nil, errInvalidTNEF
+		}
+
+		switch {
+		case level[0] == tnefLevelAttachment && id == tnefAttributeAttachRendData:
+			finishAttachment()
+			at = &Attachment{}
+		case level[0] == tnefLevelAttachment && at != nil:
+			switch id {
+			case tnefAttributeAttachTitle:
+				at.Filename = tnefString(value)
+			case tnefAttributeAttachData:
+				at.Data = bytes.NewReader(value)
+			case tnefAttributeAttachment:
+				atProps, _ = parseMAPIProperties(value)
+			}
+		case level[0] == tnefLevelMessage:
+			switch id {
+			case tnefAttributeSubject:
+				tnef.Subject = tnefString(value)
+			case tnefAttributeMessageClass:
+				tnef.MessageClass = tnefString(value)
+			case tnefAttributeBody:
+				tnef.Body = tnefString(value)
+			case tnefAttributeDateSent:
+				tnef.Date = tnefDate(value)
+			case tnefAttributeMsgProps:
+				props, err := parseMAPIProperties(value)
+				if err != nil {
+					return nil, err
+				}
+
+				tnef.Properties = append(tnef.Properties, props...)
+			}
+		}
+	}
+
+	finishAttachment()
+
+	if tnef.Subject == "" {
+		tnef.Subject = mapiString(findMAPIProperty(tnef.Properties, mapiSubject))
+	}
+
+	if tnef.Body == "" {
+		tnef.Body = mapiString(findMAPIProperty(tnef.Properties, mapiBody))
+	}
+
+	tnef.BodyHTML = mapiString(findMAPIProperty(tnef.Properties, mapiBodyHTML))
+	tnef.CompressedRTF = mapiBytes(findMAPIProperty(tnef.Properties, mapiRTFCompressed))
+
+	// Outlook often only sends the body as compressed RTF, possibly encapsulating html
+	if tnef.BodyHTML == "" || tnef.Body == "" {
+		html, text := decodeRTFBody(tnef.CompressedRTF)
+		if tnef.BodyHTML == "" {
+			tnef.BodyHTML = html
+		}
+
+		if tnef.Body == "" {
+			tnef.Body = text
+		}
+	}
+
+	return tnef, nil
+}
+
+// tnefAttachment completes the attachment with its MAPI properties
+func tnefAttachment(at Attachment, props []MAPIProperty) Attachment {
+	if name := mapiString(findMAPIProperty(props, mapiAttachLongFilename)); name != "" {
+		at.Filename = name
+	}
+
+	if at.Data == nil {
+		at.Data = bytes.NewReader(mapiBytes(findMAPIProperty(props, mapiAttachDataBinary)))
+	}
+
+	at.ContentType = mapiString(findMAPIProperty(props, mapiAttachMimeTag))
+	if at.ContentType == "" {
+		at.ContentType = contentTypeByFilename(at.Filename)
+	}
+
+	return at
+}
+
+func tnefChecksum(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+
+	return sum
+}
+
+func tnefString(value []byte) string {
+	return strings.TrimRight(string(value), "\x00")
+}
+
+// tnefDate decodes the year, month, day, hour, minute, second and day of week of a TNEF date
+func tnefDate(value []byte) time.Time {
+	if len(value) < 12 {
+		return time.Time{}
+	}
+
+	v := func(i int) int {
+		return int(binary.LittleEndian.Uint16(value[i*2:]))
+	}
+
+	return time.Date(v(0), time.Month(v(1)), v(2), v(3), v(4), v(5), 0, time.UTC)
+}
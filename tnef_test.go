@@ -0,0 +1,120 @@
+package parsemail
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeTNEFAttachments(t *testing.T) {
+	e, err := Parse(strings.NewReader(tnefExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.TNEF == nil {
+		t.Fatal("Missing TNEF")
+	}
+
+	if e.TNEF.MessageClass != "IPM.Microsoft Mail.Note" {
+		t.Errorf("Wrong message class. Expected: %s, Got: %s", "IPM.Microsoft Mail.Note", e.TNEF.MessageClass)
+	}
+
+	if e.TNEF.Subject != "Quarterly report" {
+		t.Errorf("Wrong subject. Expected: %s, Got: %s", "Quarterly report", e.TNEF.Subject)
+	}
+
+	if date := time.Date(2019, 3, 4, 10, 30, 15, 0, time.UTC); !e.TNEF.Date.Equal(date) {
+		t.Errorf("Wrong date. Expected: %s, Got: %s", date, e.TNEF.Date)
+	}
+
+	if e.TNEF.BodyHTML != "<p>Hello</p>" {
+		t.Errorf("Wrong html body. Expected: %s, Got: %s", "<p>Hello</p>", e.TNEF.BodyHTML)
+	}
+
+	if e.TNEF.Body != "hello world" {
+		t.Errorf("Wrong body. Expected: %s, Got: %s", "hello world", e.TNEF.Body)
+	}
+
+	if len(e.TNEF.CompressedRTF) != 49 || string(e.TNEF.CompressedRTF[8:12]) != "LZFu" {
+		t.Errorf("Wrong compressed RTF. Got: %x", e.TNEF.CompressedRTF)
+	}
+
+	if len(e.TNEF.Properties) != 5 {
+		t.Fatalf("Wrong number of properties. Expected: 5, Got: %v", len(e.TNEF.Properties))
+	}
+
+	if p := e.TNEF.Properties[3]; p.Name != "Custom" || p.Value != int64(7) {
+		t.Errorf("Wrong named property. Got: %+v", p)
+	}
+
+	if p := e.TNEF.Properties[4]; len(p.Value.([]interface{})) != 2 {
+		t.Errorf("Wrong multi-valued property. Got: %+v", p)
+	}
+
+	if len(e.Attachments) != 2 {
+		t.Fatalf("Wrong number of attachments. Expected: 2, Got: %v", len(e.Attachments))
+	}
+
+	at := e.Attachments[1]
+	if at.Filename != "report.txt" {
+		t.Errorf("Wrong filename. Expected: %s, Got: %s", "report.txt", at.Filename)
+	}
+
+	if at.ContentType != "text/plain" {
+		t.Errorf("Wrong content type. Expected: %s, Got: %s", "text/plain", at.ContentType)
+	}
+
+	data, _ := ioutil.ReadAll(at.Data)
+	if string(data) != "Revenue: 100\n" {
+		t.Errorf("Wrong data. Expected: %s, Got: %s", "Revenue: 100\n", data)
+	}
+}
+
+func TestParseTNEFInvalid(t *testing.T) {
+	if _, err := ParseTNEF([]byte("not a TNEF stream")); err == nil {
+		t.Error("Expected error for invalid TNEF")
+	}
+
+	e, err := Parse(strings.NewReader(strings.Replace(tnefExample, "eJ8+IgEAAQaQCAAEAAAAAAABAAEAAQiABwAYAAAASVBN", "AAAAAAEAAQaQCAAEAAAAAAABAAEAAQiABwAYAAAASVBN", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.TNEF != nil || len(e.Attachments) != 2 || e.Attachments[1].Filename != "winmail.dat" {
+		t.Errorf("Invalid TNEF attachment should be kept")
+	}
+}
+
+var tnefExample = `From: Outlook User <user@example.com>
+To: someone@example.com
+Subject: Quarterly report
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+See attached.
+--b
+Content-Type: image/png
+Content-Disposition: attachment; filename="logo.png"
+Content-Transfer-Encoding: base64
+
+iVBORw0KGgo=
+--b
+Content-Type: application/ms-tnef; name="winmail.dat"
+Content-Disposition: attachment; filename="winmail.dat"
+Content-Transfer-Encoding: base64
+
+eJ8+IgEAAQaQCAAEAAAAAAABAAEAAQiABwAYAAAASVBNLk1pY3Jvc29mdCBNYWlsLk5vdGUAMQgB
+BYADAA4AAADjBwMABAAKAB4ADwABACkBAQOQBgD4AAAABQAAAB8ANwABAAAAIgAAAFEAdQBhAHIA
+dABlAHIAbAB5ACAAcgBlAHAAbwByAHQAAAAAAAIBCRABAAAAMQAAAC0AAAArAAAATFpGdfHFx6cD
+AAoAcmNwZzEyNUIyCvMgaGVsCQAgYncFsGxkfQqAD6AAAAAeABMQAQAAAA0AAAA8cD5IZWxsbzwv
+cD4AAAAAAwABgAABAgMEBQYHCAkKCwwNDg8BAAAADgAAAEMAdQBzAHQAbwBtAAAAAAAHAAAAAxAC
+gAABAgMEBQYHCAkKCwwNDg8BAAAAEAAAAE4AdQBtAGIAZQByAHMAAAACAAAAAQAAAAIAAABYIQIC
+kAYADgAAAAEA/////wAAAAAAAAAA/QMCEIABAA0AAABSRVBPUlR+MS5UWFQAuQMCD4AGAA0AAABS
+ZXZlbnVlOiAxMDAKzwMCBZAGAEAAAAACAAAAHwAHNwEAAAAWAAAAcgBlAHAAbwByAHQALgB0AHgA
+dAAAAAAAHgAONwEAAAALAAAAdGV4dC9wbGFpbgAAFwk=
+--b--
+`
@@ -0,0 +1,341 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// uuBeginRe matches the first line of uuencoded blocks, e.g. "begin 644 file.zip", or "begin-base64 644 file.zip"
+// for blocks encoded with uuencode -m
+var uuBeginRe = regexp.MustCompile(`^begin(-base64)? [0-7]{3,4} (.+)$`)
+
+const binHexNotice = "(This file must be converted with BinHex"
+const binHexAlphabet = "!\"#$%&'()*+,-012345689@ABCDEFGHIJKLMNPQRSTUVXYZ[`abcdefhijklmpqr"
+
+// maxBinHexExpansion bounds the run length decoding of BinHex data relative to its size, as 2 bytes may expand to 255
+const maxBinHexExpansion = 32
+
+var errInvalidUUEncoding = errors.New("invalid uuencoded data")
+var errInvalidBinHex = errors.New("invalid BinHex data")
+
+// decodeUUEncoded decodes the first uuencoded block of content sent with Content-Transfer-Encoding: x-uuencode
+func decodeUUEncoded(content io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeUUEncodedData(b)
+}
+
+// decodeUUEncodedData decodes the first uuencoded block of the data
+func decodeUUEncodedData(b []byte) (io.Reader, error) {
+	lines := splitLines(string(b))
+	for i, line := range lines {
+		if !uuBeginRe.MatchString(line) {
+			continue
+		}
+
+		_, data, _, err := decodeUUBlock(lines[i:])
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(data), nil
+	}
+
+	return nil, errInvalidUUEncoding
+}
+
+// extractInlineAttachments decodes the uuencoded and BinHex blocks of the text body into attachments and removes
+// them from the text body, returning the size of the data decoded. Blocks that can't be decoded, or whose data would
+// exceed maxSize when it's positive, are left in the text body.
+func extractInlineAttachments(email *Email, maxSize int64) (decoded int) {
+	if !strings.Contains(email.TextBody, "begin") && !strings.Contains(email.TextBody, binHexNotice) {
+		return
+	}
+
+	lines := strings.Split(email.TextBody, "\n")
+	trimmed := splitLines(email.TextBody)
+
+	var kept []string
+	extracted := false
+	for i := 0; i < len(lines); i++ {
+		var filename string
+		var data []byte
+		var n int
+		var err error
+
+		switch {
+		case uuBeginRe.MatchString(trimmed[i]):
+			filename, data, n, err = decodeUUBlock(trimmed[i:])
+		case strings.HasPrefix(trimmed[i], binHexNotice):
+			filename, data, n, err = decodeBinHexBlock(trimmed[i:], maxSize)
+		default:
+			kept = append(kept, lines[i])
+			continue
+		}
+
+		if err != nil || (maxSize > 0 && int64(len(data)) > maxSize) {
+			kept = append(kept, lines[i])
+			continue
+		}
+
+		email.Attachments = append(email.Attachments, Attachment{
+			Filename:    filename,
+			ContentType: contentTypeByFilename(filename),
+			Data:        bytes.NewReader(data),
+		})
+
+		extracted = true
+		decoded += len(data)
+		i += n - 1
+
+		// don't leave the blank lines around the block behind
+		for i+1 < len(lines) && trimmed[i+1] == "" && (len(kept) == 0 || strings.TrimRight(kept[len(kept)-1], "\r") == "") {
+			i++
+		}
+	}
+
+	if extracted {
+		email.TextBody = strings.TrimRight(strings.Join(kept, "\n"), "\r\n")
+	}
+
+	return
+}
+
+// decodeUUBlock decodes the uuencoded block starting at the first line and returns its filename, data and the
+// number of lines it spans
+func decodeUUBlock(lines []string) (filename string, data []byte, n int, err error) {
+	m := uuBeginRe.FindStringSubmatch(lines[0])
+	if m == nil {
+		return "", nil, 0, errInvalidUUEncoding
+	}
+
+	filename = filepath.Base(strings.Replace(m[2], "\\", "/", -1))
+
+	if m[1] != "" {
+		var encoded strings.Builder
+		for i, line := range lines[1:] {
+			if line == "====" {
+				data, err = base64.StdEncoding.DecodeString(encoded.String())
+				return filename, data, i + 2, err
+			}
+
+			encoded.WriteString(line)
+		}
+
+		return "", nil, 0, errInvalidUUEncoding
+	}
+
+	for i, line := range lines[1:] {
+		if line == "end" {
+			return filename, data, i + 2, nil
+		}
+
+		decoded, err := decodeUULine(line)
+		if err != nil {
+			return "", nil, 0, err
+		}
+
+		data = append(data, decoded...)
+	}
+
+	return "", nil, 0, errInvalidUUEncoding
+}
+
+func decodeUULine(line string) ([]byte, error) {
+	if line == "" {
+		return nil, nil
+	}
+
+	n := int((line[0] - ' ') & 63)
+	encoded := line[1:]
+
+	// some encoders strip trailing spaces or append a checksum character
+	if len(encoded) < (n*4+2)/3 || len(encoded) > (n+2)/3*4+1 {
+		return nil, errInvalidUUEncoding
+	}
+
+	data := make([]byte, 0, n+2)
+	for i := 0; len(data) < n; i += 4 {
+		var c [4]byte
+		for j := range c {
+			if i+j < len(encoded) {
+				if encoded[i+j] < ' ' || encoded[i+j] > '`' {
+					return nil, errInvalidUUEncoding
+				}
+
+				c[j] = (encoded[i+j] - ' ') & 63
+			}
+		}
+
+		data = append(data, c[0]<<2|c[1]>>4, c[1]<<4|c[2]>>2, c[2]<<6|c[3])
+	}
+
+	return data[:n], nil
+}
+
+// decodeBinHexBlock decodes the data fork of the BinHex 4.0 block following the notice at the first line and
+// returns its filename, data and the number of lines it spans
+func decodeBinHexBlock(lines []string, maxSize int64) (filename string, data []byte, n int, err error) {
+	var encoded strings.Builder
+
+	started := false
+	for i, line := range lines[1:] {
+		if !started {
+			if line == "" {
+				continue
+			}
+
+			if !strings.HasPrefix(line, ":") {
+				return "", nil, 0, errInvalidBinHex
+			}
+
+			started = true
+			line = line[1:]
+		}
+
+		if end := strings.IndexByte(line, ':'); end != -1 {
+			encoded.WriteString(line[:end])
+			filename, data, err = decodeBinHex(encoded.String(), maxSize)
+
+			return filename, data, i + 2, err
+		}
+
+		encoded.WriteString(line)
+	}
+
+	return "", nil, 0, errInvalidBinHex
+}
+
+// decodeBinHex decodes BinHex 4.0 data between the colons and returns the name and data fork of the file. The
+// decoded data is limited to maxBinHexExpansion times the encoded data, and to maxSize when it's positive.
+func decodeBinHex(encoded string, maxSize int64) (string, []byte, error) {
+	var packed []byte
+	var bits uint
+	var buffer uint32
+
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		if isHTMLSpace(c) {
+			continue
+		}
+
+		v := strings.IndexByte(binHexAlphabet, c)
+		if v == -1 {
+			return "", nil, errInvalidBinHex
+		}
+
+		buffer = buffer<<6 | uint32(v)
+		bits += 6
+		if bits >= 8 {
+			bits -= 8
+			packed = append(packed, byte(buffer>>bits))
+		}
+	}
+
+	limit := int64(len(packed)) * maxBinHexExpansion
+	if maxSize > 0 && maxSize < limit {
+		limit = maxSize
+	}
+
+	// run length decoding, 0x90 is followed by the number of repetitions of the previous byte or 0 for a literal 0x90
+	var b []byte
+	for i := 0; i < len(packed); i++ {
+		if packed[i] != 0x90 {
+			b = append(b, packed[i])
+			continue
+		}
+
+		if i+1 >= len(packed) {
+			return "", nil, errInvalidBinHex
+		}
+
+		i++
+		if packed[i] == 0 {
+			b = append(b, 0x90)
+			continue
+		}
+
+		if len(b) == 0 {
+			return "", nil, errInvalidBinHex
+		}
+
+		if int64(len(b)+int(packed[i])) > limit {
+			return "", nil, errInvalidBinHex
+		}
+
+		for k := 1; k < int(packed[i]); k++ {
+			b = append(b, b[len(b)-1])
+		}
+	}
+
+	if int64(len(b)) > limit || len(b) < 1 || len(b) < 1+int(b[0])+22 {
+		return "", nil, errInvalidBinHex
+	}
+
+	// name, version, type, creator, flags, data fork length, resource fork length, crc
+	name := string(b[1 : 1+b[0]])
+	p := 1 + int(b[0]) + 1 + 4 + 4 + 2
+	dataLength := int(binary.BigEndian.Uint32(b[p:]))
+	if crc16(b[:p+8]) != binary.BigEndian.Uint16(b[p+8:]) {
+		return "", nil, errInvalidBinHex
+	}
+
+	p += 10
+	if dataLength < 0 || len(b) < p+dataLength+2 {
+		return "", nil, errInvalidBinHex
+	}
+
+	data := b[p : p+dataLength]
+	if crc16(data) != binary.BigEndian.Uint16(b[p+dataLength:]) {
+		return "", nil, errInvalidBinHex
+	}
+
+	return name, data, nil
+}
+
+// crc16 is the CRC-CCITT (XMODEM) checksum used by BinHex
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// splitLines splits the text into lines without line endings
+func splitLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+
+	return lines
+}
+
+// contentTypeByFilename returns the media type for the extension of the filename, without parameters
+func contentTypeByFilename(filename string) string {
+	if t, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(filename))); err == nil {
+		return t
+	}
+
+	return "application/octet-stream"
+}
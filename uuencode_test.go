@@ -0,0 +1,197 @@
+package parsemail
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestExtractInlineAttachments(t *testing.T) {
+	e, err := Parse(strings.NewReader(inlineAttachmentsExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.TextBody != "Please see the attached files.\n\nBest regards" {
+		t.Errorf("Wrong text body. Got: '%s'", e.TextBody)
+	}
+
+	var testData = map[int]struct {
+		filename    string
+		contentType string
+		data        string
+	}{
+		0: {
+			filename:    "hello.txt",
+			contentType: "text/plain",
+			data:        "Hello from uuencode!\nThis is the attached file.\n",
+		},
+		1: {
+			filename:    "notes.txt",
+			contentType: "text/plain",
+			data:        "BinHex data fork \x90 with aaaaaaaaaa run\n",
+		},
+	}
+
+	if len(e.Attachments) != len(testData) {
+		t.Fatalf("Wrong number of attachments. Expected: %v, Got: %v", len(testData), len(e.Attachments))
+	}
+
+	for index, td := range testData {
+		at := e.Attachments[index]
+		if at.Filename != td.filename {
+			t.Errorf("[Test Case %v] Wrong filename. Expected: %s, Got: %s", index, td.filename, at.Filename)
+		}
+
+		if at.ContentType != td.contentType {
+			t.Errorf("[Test Case %v] Wrong content type. Expected: %s, Got: %s", index, td.contentType, at.ContentType)
+		}
+
+		data, _ := ioutil.ReadAll(at.Data)
+		if string(data) != td.data {
+			t.Errorf("[Test Case %v] Wrong data. Expected: '%s', Got: '%s'", index, td.data, data)
+		}
+	}
+}
+
+func TestExtractInlineAttachmentsInvalid(t *testing.T) {
+	text := "We begin 644 hours later.\nbegin 644 broken.txt\nthis is not uuencoded\nend"
+	email := Email{TextBody: text}
+	extractInlineAttachments(&email, 0)
+
+	if email.TextBody != text || len(email.Attachments) != 0 {
+		t.Errorf("Invalid block was extracted: %+v", email)
+	}
+}
+
+func TestExtractInlineAttachmentsSizeLimit(t *testing.T) {
+	body := strings.SplitN(inlineAttachmentsExample, "\n\n", 2)[1]
+	bomb := "(This file must be converted with BinHex 4.0)\n:" + encodeBinHex("zeros.bin", make([]byte, 1<<20)) + ":"
+
+	var testData = map[int]struct {
+		text        string
+		maxSize     int64
+		attachments int
+	}{
+		1: {text: body, attachments: 2},
+		2: {text: body, maxSize: 16, attachments: 0},
+		3: {text: "(This file must be converted with BinHex 4.0)\n:" + encodeBinHex("zeros.bin", make([]byte, 1024)) + ":", attachments: 1},
+		4: {text: bomb, attachments: 0},
+	}
+
+	for index, td := range testData {
+		email := Email{TextBody: td.text}
+		extractInlineAttachments(&email, td.maxSize)
+
+		if len(email.Attachments) != td.attachments {
+			t.Errorf("[Test Case %v] Wrong number of attachments. Expected: %v, Got: %v", index, td.attachments, len(email.Attachments))
+		}
+	}
+}
+
+// encodeBinHex encodes the file as BinHex 4.0 data, run length encoding repeated bytes
+func encodeBinHex(name string, data []byte) string {
+	header := append([]byte{byte(len(name))}, name...)
+	header = append(header, make([]byte, 1+4+4+2)...)
+	header = append(header, byte(len(data)>>24), byte(len(data)>>16), byte(len(data)>>8), byte(len(data)), 0, 0, 0, 0)
+	crc := crc16(header)
+	header = append(header, byte(crc>>8), byte(crc))
+
+	raw := append(header, data...)
+	crc = crc16(data)
+	raw = append(raw, byte(crc>>8), byte(crc), 0, 0)
+
+	var packed []byte
+	for i := 0; i < len(raw); {
+		n := 1
+		for i+n < len(raw) && raw[i+n] == raw[i] && n < 255 {
+			n++
+		}
+
+		if raw[i] == 0x90 {
+			packed = append(packed, 0x90, 0)
+			n = 1
+		} else if n > 2 {
+			packed = append(packed, raw[i], 0x90, byte(n))
+		} else {
+			packed = append(packed, raw[i])
+			n = 1
+		}
+
+		i += n
+	}
+
+	var b strings.Builder
+	var buffer uint32
+	var bits uint
+	for _, c := range packed {
+		buffer = buffer<<8 | uint32(c)
+		bits += 8
+		for bits >= 6 {
+			bits -= 6
+			b.WriteByte(binHexAlphabet[buffer>>bits&0x3f])
+		}
+	}
+
+	if bits > 0 {
+		b.WriteByte(binHexAlphabet[buffer<<(6-bits)&0x3f])
+	}
+
+	return b.String()
+}
+
+func TestDecodeContentUUEncode(t *testing.T) {
+	e, err := Parse(strings.NewReader(uuencodeAttachmentExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Attachments) != 1 {
+		t.Fatalf("Wrong number of attachments. Expected: 1, Got: %v", len(e.Attachments))
+	}
+
+	data, _ := ioutil.ReadAll(e.Attachments[0].Data)
+	if string(data) != "Hello from uuencode!\nThis is the attached file.\n" {
+		t.Errorf("Wrong data. Got: '%s'", data)
+	}
+}
+
+var uuencodedExample = `begin 644 hello.txt
+M2&5L;&\@9G)O;2!U=65N8V]D92$*5&AI<R!I<R!T:&4@871T86-H960@9FEL
+#92X*
+` + "`" + `
+end`
+
+var inlineAttachmentsExample = `From: Old Client <old@example.com>
+To: someone@example.com
+Subject: Files
+Content-Type: text/plain
+
+Please see the attached files.
+
+` + uuencodedExample + `
+
+(This file must be converted with BinHex 4.0)
+:#@j[G'9c,R4iG!"849K8G(4iG!#3"5F!N!5HEN*TENKPH#"NBA4K)'C[FQXJN!!
+JGfPdD#"KN!SJFR9Z#Q+$!!!:
+
+Best regards
+`
+
+var uuencodeAttachmentExample = `From: Old Client <old@example.com>
+To: someone@example.com
+Subject: File
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+See attachment.
+--b
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="hello.txt"
+Content-Transfer-Encoding: x-uuencode
+
+` + uuencodedExample + `
+--b--
+`
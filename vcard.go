@@ -0,0 +1,268 @@
+package parsemail
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"path"
+	"strings"
+)
+
+// Contact with the common properties of a vCard (versions 2.1, 3.0 and 4.0)
+type Contact struct {
+	Version       string
+	FormattedName string
+	FamilyName    string
+	GivenName     string
+	Nickname      string
+	Organization  string
+	Title         string
+	Birthday      string
+	Note          string
+
+	Emails    []ContactField
+	Phones    []ContactField
+	Addresses []ContactField
+	URLs      []ContactField
+}
+
+// ContactField with a value of a repeatable vCard property and its lower cased types (e.g. "work", "cell")
+type ContactField struct {
+	Value string
+	Types []string
+}
+
+func (s *parseState) parseContactPart(part *multipart.Part, email *Email) error {
+	decoded, err := s.decodeContent(part, part.Header.Get("Content-Transfer-Encoding"))
+	if err != nil {
+		return err
+	}
+
+	contacts, err := parseContactData(decoded)
+	if err != nil {
+		return err
+	}
+
+	email.Contacts = append(email.Contacts, contacts...)
+
+	return nil
+}
+
+func isContactAttachment(at Attachment) bool {
+	switch strings.ToLower(at.ContentType) {
+	case contentTypeTextVCard, contentTypeTextXVCard, "text/directory":
+		return true
+	}
+
+	ext := strings.ToLower(path.Ext(at.Filename))
+
+	return ext == ".vcf" || ext == ".vcard"
+}
+
+func decodeContactAttachments(email *Email) error {
+	for _, at := range email.Attachments {
+		if isContactAttachment(at) {
+			data, err := readData(at.Data)
+			if err != nil {
+				return err
+			}
+
+			email.Contacts = append(email.Contacts, parseContacts(string(data))...)
+		}
+	}
+
+	return nil
+}
+
+func parseContactData(r io.Reader) ([]Contact, error) {
+	data, err := readData(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseContacts(string(data)), nil
+}
+
+func parseContacts(data string) (contacts []Contact) {
+	var c *Contact
+
+	for _, line := range unfoldContentLines(joinQuotedPrintableLines(data)) {
+		cl, ok := parseContentLine(line)
+		if !ok {
+			continue
+		}
+
+		switch strings.ToUpper(cl.params["ENCODING"]) {
+		case "QUOTED-PRINTABLE":
+			cl.value = decodeContactQuotedPrintable(cl.value, cl.params["CHARSET"])
+		case "BASE64", "B":
+			cl.value = decodeContactBase64(cl.value, cl.params["CHARSET"])
+		}
+
+		switch cl.name {
+		case "BEGIN":
+			if strings.EqualFold(cl.value, "VCARD") {
+				contacts = append(contacts, Contact{})
+				c = &contacts[len(contacts)-1]
+			}
+
+			continue
+		case "END":
+			c = nil
+			continue
+		}
+
+		if c == nil {
+			continue
+		}
+
+		field := ContactField{Value: unescapeText(cl.value), Types: contactTypes(cl.params)}
+
+		switch cl.name {
+		case "VERSION":
+			c.Version = cl.value
+		case "FN":
+			c.FormattedName = unescapeText(cl.value)
+		case "N":
+			n := splitStructuredValue(cl.value)
+			c.FamilyName = n[0]
+			if len(n) > 1 {
+				c.GivenName = n[1]
+			}
+		case "NICKNAME":
+			c.Nickname = unescapeText(cl.value)
+		case "ORG":
+			c.Organization = strings.Join(nonEmpty(splitStructuredValue(cl.value)), ", ")
+		case "TITLE":
+			c.Title = unescapeText(cl.value)
+		case "BDAY":
+			c.Birthday = cl.value
+		case "NOTE":
+			c.Note = unescapeText(cl.value)
+		case "EMAIL":
+			c.Emails = append(c.Emails, field)
+		case "TEL":
+			field.Value = strings.TrimPrefix(field.Value, "tel:")
+			c.Phones = append(c.Phones, field)
+		case "ADR":
+			field.Value = strings.Join(nonEmpty(splitStructuredValue(cl.value)), ", ")
+			c.Addresses = append(c.Addresses, field)
+		case "URL":
+			c.URLs = append(c.URLs, field)
+		}
+	}
+
+	for i := range contacts {
+		if contacts[i].FormattedName == "" {
+			contacts[i].FormattedName = strings.TrimSpace(contacts[i].GivenName + " " + contacts[i].FamilyName)
+		}
+	}
+
+	return
+}
+
+// joinQuotedPrintableLines undoes the soft line breaks of vCard 2.1 quoted-printable properties, which are not
+// folded with leading whitespace
+func joinQuotedPrintableLines(data string) string {
+	lines := strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n")
+	var result []string
+
+	qp := false
+	for _, line := range lines {
+		if qp && len(result) > 0 {
+			result[len(result)-1] = strings.TrimSuffix(result[len(result)-1], "=") + line
+		} else {
+			result = append(result, line)
+		}
+
+		current := result[len(result)-1]
+		header := current
+		if i := strings.Index(current, ":"); i != -1 {
+			header = current[:i]
+		}
+
+		qp = strings.Contains(strings.ToUpper(header), "QUOTED-PRINTABLE") && strings.HasSuffix(current, "=")
+	}
+
+	return strings.Join(result, "\n")
+}
+
+func decodeContactQuotedPrintable(value, charset string) string {
+	b, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(value)))
+	if err != nil {
+		return value
+	}
+
+	return decodeContactCharset(b, charset)
+}
+
+func decodeContactBase64(value, charset string) string {
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return value
+	}
+
+	return decodeContactCharset(b, charset)
+}
+
+// decodeContactCharset converts decoded vCard 2.1 values in the Latin-1 charsets to UTF-8
+func decodeContactCharset(b []byte, charset string) string {
+	codepage := 0
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		codepage = 28591
+	case "windows-1252", "cp1252":
+		codepage = 1252
+	default:
+		return string(b)
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = decodeCodepageByte(c, codepage)
+	}
+
+	return string(runes)
+}
+
+func contactTypes(params map[string]string) (types []string) {
+	for _, t := range strings.Split(params["TYPE"], ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && t != "internet" && t != "pref" {
+			types = append(types, t)
+		}
+	}
+
+	if params["PREF"] != "" || strings.Contains(strings.ToLower(params["TYPE"]), "pref") {
+		types = append(types, "pref")
+	}
+
+	return
+}
+
+// splitStructuredValue splits a value on unescaped semicolons and unescapes the components
+func splitStructuredValue(value string) (result []string) {
+	start := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' {
+			i++
+		} else if value[i] == ';' {
+			result = append(result, unescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(result, unescapeText(value[start:]))
+}
+
+func nonEmpty(values []string) (result []string) {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			result = append(result, strings.TrimSpace(v))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,146 @@
+package parsemail
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseContacts(t *testing.T) {
+	var testData = map[int]struct {
+		vcard    string
+		contacts []Contact
+	}{
+		1: {
+			vcard: "BEGIN:VCARD\r\nVERSION:2.1\r\nN;CHARSET=ISO-8859-1;ENCODING=QUOTED-PRINTABLE:Pahol=EDk;Peter\r\n" +
+				"FN:Peter Pahol\r\n ik\r\nTEL;WORK;VOICE:+421 123 456\r\n" +
+				"ADR;HOME;ENCODING=QUOTED-PRINTABLE:;;Hlavn=C3=A1 1;Bratislava;;81101;Slov=\r\nakia\r\n" +
+				"EMAIL;PREF;INTERNET:peter@example.com\r\nEND:VCARD\r\n",
+			contacts: []Contact{
+				{
+					Version:       "2.1",
+					FormattedName: "Peter Paholik",
+					FamilyName:    "Paholík",
+					GivenName:     "Peter",
+					Emails:        []ContactField{{Value: "peter@example.com", Types: []string{"pref"}}},
+					Phones:        []ContactField{{Value: "+421 123 456", Types: []string{"work", "voice"}}},
+					Addresses:     []ContactField{{Value: "Hlavná 1, Bratislava, 81101, Slovakia", Types: []string{"home"}}},
+				},
+			},
+		},
+		2: {
+			vcard: "BEGIN:VCARD\nVERSION:3.0\nN:Doe;John;;;\nFN:John Doe\nORG:Example\\, Inc.;Sales\n" +
+				"TITLE:Manager\nitem1.EMAIL;TYPE=INTERNET,WORK:jdoe@machine.example\nTEL;TYPE=CELL:+1 555 0100\n" +
+				"NOTE:Line one\\nLine two\nEND:VCARD\nBEGIN:VCARD\nVERSION:4.0\nFN:Mary Smith\n" +
+				"EMAIL;TYPE=\"home,work\";PREF=1:mary@example.net\nTEL;VALUE=uri;TYPE=voice:tel:+1-555-0101\n" +
+				"URL:https://example.net/mary\nEND:VCARD\n",
+			contacts: []Contact{
+				{
+					Version:       "3.0",
+					FormattedName: "John Doe",
+					FamilyName:    "Doe",
+					GivenName:     "John",
+					Organization:  "Example, Inc., Sales",
+					Title:         "Manager",
+					Note:          "Line one\nLine two",
+					Emails:        []ContactField{{Value: "jdoe@machine.example", Types: []string{"work"}}},
+					Phones:        []ContactField{{Value: "+1 555 0100", Types: []string{"cell"}}},
+				},
+				{
+					Version:       "4.0",
+					FormattedName: "Mary Smith",
+					Emails:        []ContactField{{Value: "mary@example.net", Types: []string{"home", "work", "pref"}}},
+					Phones:        []ContactField{{Value: "+1-555-0101", Types: []string{"voice"}}},
+					URLs:          []ContactField{{Value: "https://example.net/mary"}},
+				},
+			},
+		},
+		3: {
+			vcard: "BEGIN:VCARD\r\nVERSION:2.1\r\nFN;CHARSET=UTF-8;QUOTED-PRINTABLE:Peter Pahol=C3=ADk\r\n" +
+				"ADR;HOME;QUOTED-PRINTABLE:;;Hlavn=C3=A1 1;Bratislava;;81101;Slov=\r\nakia\r\n" +
+				"TEL;CELL;8BIT:+421 123 456\r\nNOTE;BASE64:Tm90ZQ==\r\nEND:VCARD\r\n",
+			contacts: []Contact{
+				{
+					Version:       "2.1",
+					FormattedName: "Peter Paholík",
+					Note:          "Note",
+					Phones:        []ContactField{{Value: "+421 123 456", Types: []string{"cell"}}},
+					Addresses:     []ContactField{{Value: "Hlavná 1, Bratislava, 81101, Slovakia", Types: []string{"home"}}},
+				},
+			},
+		},
+		4: {
+			vcard: "BEGIN:VCARD\r\nVERSION:2.1\r\nFN;CHARSET=windows-1252;ENCODING=QUOTED-PRINTABLE:=93Peter=94 Pahol=EDk\r\n" +
+				"NOTE;CHARSET=windows-1252;ENCODING=QUOTED-PRINTABLE:Price =80 5\r\nEND:VCARD\r\n",
+			contacts: []Contact{
+				{
+					Version:       "2.1",
+					FormattedName: "“Peter” Paholík",
+					Note:          "Price € 5",
+				},
+			},
+		},
+	}
+
+	for index, td := range testData {
+		contacts := parseContacts(td.vcard)
+		if !reflect.DeepEqual(td.contacts, contacts) {
+			t.Errorf("[Test Case %v] Wrong contacts. Expected: %+v, Got: %+v", index, td.contacts, contacts)
+		}
+	}
+}
+
+func TestParseContactsFromEmail(t *testing.T) {
+	e, err := Parse(strings.NewReader(vcardMailExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.TextBody != "Regards, John" {
+		t.Errorf("Wrong text body. Got: '%s'", e.TextBody)
+	}
+
+	if len(e.Attachments) != 1 {
+		t.Errorf("Incorrect number of attachments! Expected: 1, Got: %v.", len(e.Attachments))
+	}
+
+	if len(e.Contacts) != 2 || e.Contacts[0].FormattedName != "John Doe" || e.Contacts[1].FormattedName != "Mary Smith" {
+		t.Errorf("Wrong contacts. Got: %+v", e.Contacts)
+	}
+
+	e, err = Parse(strings.NewReader(strings.NewReplacer("text/vcard", "Text/VCard", "mary.vcf", "mary.dat").
+		Replace(vcardMailExample)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Contacts) != 2 || e.Contacts[1].FormattedName != "Mary Smith" {
+		t.Errorf("Wrong contacts of attachment with upper case type. Got: %+v", e.Contacts)
+	}
+}
+
+var vcardMailExample = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: Contacts
+Date: Fri, 21 Nov 1997 09:55:06 -0600
+Content-Type: multipart/mixed; boundary="000000000000ab2e2205a26de587"
+
+--000000000000ab2e2205a26de587
+Content-Type: text/plain; charset="UTF-8"
+
+Regards, John
+--000000000000ab2e2205a26de587
+Content-Type: text/x-vcard; charset="UTF-8"
+
+BEGIN:VCARD
+VERSION:3.0
+FN:John Doe
+END:VCARD
+--000000000000ab2e2205a26de587
+Content-Type: text/vcard; name="mary.vcf"
+Content-Disposition: attachment; filename="mary.vcf"
+Content-Transfer-Encoding: base64
+
+QkVHSU46VkNBUkQNClZFUlNJT046NC4wDQpGTjpNYXJ5IFNtaXRoDQpFTkQ6VkNBUkQNCg==
+--000000000000ab2e2205a26de587--
+`